@@ -1,16 +1,21 @@
 module github.com/tatamiya/new-books-notification
 
-go 1.15
+go 1.16
 
 require (
 	cloud.google.com/go v0.90.0
 	cloud.google.com/go/bigquery v1.8.0
 	cloud.google.com/go/storage v1.10.0
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.16
+	github.com/minio/minio-go/v7 v7.0.12
 	github.com/mmcdole/gofeed v1.1.3
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/slack-go/slack v0.9.0
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/time v0.0.0-20210723032227-1f47c861a9ac
 	google.golang.org/api v0.54.0
 	google.golang.org/genproto v0.0.0-20220630174209-ad1d48641aa7 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
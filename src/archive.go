@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tatamiya/new-books-notification/src/feeds"
+	"github.com/tatamiya/new-books-notification/src/models"
+	"github.com/tatamiya/new-books-notification/src/recorder"
+	"github.com/tatamiya/new-books-notification/src/uploader"
+)
+
+// runManifest lists the objects archived by a run, so that the archive can be read without BigQuery.
+type runManifest struct {
+	UploadDate string          `json:"upload_date"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Books      int             `json:"books"`
+	Objects    []manifestEntry `json:"objects"`
+	// Failed are the objects which could not be uploaded.
+	Failed []string `json:"failed,omitempty"`
+}
+
+type manifestEntry struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	MD5         string `json:"md5"`
+}
+
+// archiveRun archives the raw feeds and the books processed by the run at runAt with their details,
+// as JSON Lines and CSV in the columns of the records, e.g. "feed20240801.run-20240801T224200.books.jsonl" next to "feed20240801.json".
+// The manifest "feed20240801.run-20240801T224200.manifest.json" is uploaded last, so that it tells the archive of the run is complete.
+// The objects are named after the run, so that a re-run of the day keeps the books archived by the earlier run,
+// and without books only the feeds and the manifest are uploaded, so that the run is told complete as well.
+func archiveRun(objectUploader Uploader, sourceFeeds []*feeds.SourceFeed, books *models.BookList, withSourceName bool, pathTemplate string, runAt time.Time) {
+
+	uploaded, failed := uploadFeeds(objectUploader, sourceFeeds, withSourceName, pathTemplate)
+	manifest := runManifest{
+		UploadDate: books.UploadDate.Format("2006-01-02"),
+		CreatedAt:  runAt,
+		Books:      len(books.Books),
+		Failed:     failed,
+	}
+
+	baseName := uploader.RunPrefix(uploader.ExpandPathTemplate(pathTemplate, books.UploadDate), runAt)
+	var bookObjects []*uploader.UploadObject
+	if len(books.Books) == 0 {
+		log.Println("No books to archive; only the feeds and the manifest are uploaded.")
+	} else {
+		var err error
+		bookObjects, err = generateBookListObjects(books, baseName)
+		if err != nil {
+			log.Printf("Book list upload failed: %s", err)
+		}
+	}
+	for _, object := range bookObjects {
+		if err := objectUploader.Upload(object); err != nil {
+			log.Printf("Book list upload failed: %s", err)
+			manifest.Failed = append(manifest.Failed, object.ObjectName)
+			continue
+		}
+		uploaded = append(uploaded, object)
+	}
+
+	for _, object := range uploaded {
+		sum := md5.Sum(object.Binary)
+		manifest.Objects = append(manifest.Objects, manifestEntry{
+			Name:        object.ObjectName,
+			ContentType: object.ContentType,
+			Size:        len(object.Binary),
+			MD5:         hex.EncodeToString(sum[:]),
+		})
+	}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		log.Printf("Manifest upload failed: %s", err)
+		return
+	}
+	err = objectUploader.Upload(&uploader.UploadObject{
+		ObjectName:  baseName + uploader.ManifestSuffix,
+		ContentType: "application/json",
+		Binary:      b,
+	})
+	if err != nil {
+		log.Printf("Manifest upload failed: %s", err)
+	}
+}
+
+// generateBookListObjects encodes the books as JSON Lines and CSV named after the run prefix baseName.
+func generateBookListObjects(books *models.BookList, baseName string) ([]*uploader.UploadObject, error) {
+
+	jsonLines, err := recorder.EncodeJSONLines(books)
+	if err != nil {
+		return nil, fmt.Errorf("failed in converting books into JSON Lines: %s", err)
+	}
+	csvData, err := recorder.EncodeCSV(books)
+	if err != nil {
+		return nil, fmt.Errorf("failed in converting books into CSV: %s", err)
+	}
+
+	return []*uploader.UploadObject{
+		{ObjectName: baseName + ".books.jsonl", ContentType: "application/x-ndjson", Binary: jsonLines},
+		{ObjectName: baseName + ".books.csv", ContentType: "text/csv", Binary: csvData},
+	}, nil
+}
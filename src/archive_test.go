@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/new-books-notification/src/feeds"
+	"github.com/tatamiya/new-books-notification/src/models"
+	"github.com/tatamiya/new-books-notification/src/uploader"
+)
+
+type UploaderStub struct {
+	Objects    []*uploader.UploadObject
+	FailedName string
+	// NoOverwrite rejects the objects uploaded already, as GCSUploader with NoOverwrite.
+	NoOverwrite bool
+}
+
+func (u *UploaderStub) Upload(object *uploader.UploadObject) error {
+	if object.ObjectName == u.FailedName {
+		return fmt.Errorf("Cannot upload %s!", object.ObjectName)
+	}
+	if u.NoOverwrite {
+		for _, uploaded := range u.Objects {
+			if uploaded.ObjectName == object.ObjectName {
+				return fmt.Errorf("Cannot upload %s: %w", object.ObjectName, uploader.ErrObjectExists)
+			}
+		}
+	}
+	u.Objects = append(u.Objects, object)
+	return nil
+}
+
+func TestArchiveRunUploadsBooksAndManifest(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	sourceFeeds := []*feeds.SourceFeed{
+		{Source: feeds.Source{Name: "hanmoto"}, Feed: &gofeed.Feed{PublishedParsed: &date}},
+		{Source: feeds.Source{Name: "genre"}, Feed: &gofeed.Feed{PublishedParsed: &date}},
+	}
+	books := &models.BookList{UploadDate: date, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "Book1", PubDate: date, Price: 2400, Ccode: "C0040"},
+		{Isbn: "2222222222222", Title: "Book2", PubDate: date},
+	}}
+	stub := UploaderStub{FailedName: "2024/08/feed20240801_genre.json"}
+
+	archiveRun(&stub, sourceFeeds, books, true, "{yyyy}/{mm}/feed{yyyymmdd}.json", date.Add(10*time.Minute))
+
+	var names []string
+	for _, object := range stub.Objects {
+		names = append(names, object.ObjectName)
+	}
+	assert.Equal(t, []string{
+		"2024/08/feed20240801_hanmoto.json",
+		"2024/08/feed20240801.run-20240801T225200.books.jsonl",
+		"2024/08/feed20240801.run-20240801T225200.books.csv",
+		"2024/08/feed20240801.run-20240801T225200.manifest.json",
+	}, names)
+
+	jsonLines := strings.Split(strings.TrimSpace(string(stub.Objects[1].Binary)), "\n")
+	assert.Equal(t, 2, len(jsonLines))
+	assert.Contains(t, jsonLines[0], `"Ccode":"C0040"`)
+	assert.Equal(t, 3, len(strings.Split(strings.TrimSpace(string(stub.Objects[2].Binary)), "\n")))
+
+	var manifest runManifest
+	assert.Nil(t, json.Unmarshal(stub.Objects[3].Binary, &manifest))
+	assert.Equal(t, "2024-08-01", manifest.UploadDate)
+	assert.Equal(t, 2, manifest.Books)
+	assert.Equal(t, 3, len(manifest.Objects))
+	assert.Equal(t, "2024/08/feed20240801.run-20240801T225200.books.jsonl", manifest.Objects[1].Name)
+	assert.Equal(t, len(stub.Objects[1].Binary), manifest.Objects[1].Size)
+	assert.Equal(t, 32, len(manifest.Objects[1].MD5))
+	assert.Equal(t, []string{"2024/08/feed20240801_genre.json"}, manifest.Failed)
+}
+
+func TestArchiveRunKeepsBooksOfEarlierRunOfTheDay(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	sourceFeeds := []*feeds.SourceFeed{
+		{Source: feeds.Source{Name: "hanmoto"}, Feed: &gofeed.Feed{PublishedParsed: &date}},
+	}
+	stub := UploaderStub{}
+
+	archiveRun(&stub, sourceFeeds, &models.BookList{UploadDate: date, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "Book1", PubDate: date},
+		{Isbn: "2222222222222", Title: "Book2", PubDate: date},
+	}}, false, uploader.DefaultPathTemplate, date)
+	archiveRun(&stub, sourceFeeds, &models.BookList{UploadDate: date, Books: []*models.Book{
+		{Isbn: "3333333333333", Title: "Book3", PubDate: date},
+	}}, false, uploader.DefaultPathTemplate, date.Add(time.Hour))
+	archiveRun(&stub, sourceFeeds, &models.BookList{UploadDate: date}, false, uploader.DefaultPathTemplate, date.Add(2*time.Hour))
+
+	objects := make(map[string][]byte)
+	var names []string
+	for _, object := range stub.Objects {
+		objects[object.ObjectName] = object.Binary
+		names = append(names, object.ObjectName)
+	}
+	assert.Equal(t, []string{
+		"feed20240801.json",
+		"feed20240801.run-20240801T224200.books.jsonl",
+		"feed20240801.run-20240801T224200.books.csv",
+		"feed20240801.run-20240801T224200.manifest.json",
+		"feed20240801.json",
+		"feed20240801.run-20240801T234200.books.jsonl",
+		"feed20240801.run-20240801T234200.books.csv",
+		"feed20240801.run-20240801T234200.manifest.json",
+		"feed20240801.json",
+		"feed20240801.run-20240802T004200.manifest.json",
+	}, names)
+
+	firstRunBooks := strings.Split(strings.TrimSpace(string(objects["feed20240801.run-20240801T224200.books.jsonl"])), "\n")
+	assert.Equal(t, 2, len(firstRunBooks))
+	assert.Contains(t, firstRunBooks[0], `"ISBN":"1111111111111"`)
+	var manifest runManifest
+	assert.Nil(t, json.Unmarshal(objects["feed20240801.run-20240801T224200.manifest.json"], &manifest))
+	assert.Equal(t, 2, manifest.Books)
+}
+
+func TestArchiveRunUploadsManifestWithoutBooks(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	sourceFeeds := []*feeds.SourceFeed{
+		{Source: feeds.Source{Name: "hanmoto"}, Feed: &gofeed.Feed{PublishedParsed: &date}},
+	}
+	stub := UploaderStub{}
+
+	archiveRun(&stub, sourceFeeds, &models.BookList{UploadDate: date}, false, uploader.DefaultPathTemplate, date)
+
+	assert.Equal(t, 2, len(stub.Objects))
+	assert.Equal(t, "feed20240801.json", stub.Objects[0].ObjectName)
+	assert.Equal(t, "feed20240801.run-20240801T224200.manifest.json", stub.Objects[1].ObjectName)
+
+	var manifest runManifest
+	assert.Nil(t, json.Unmarshal(stub.Objects[1].Binary, &manifest))
+	assert.Equal(t, "2024-08-01", manifest.UploadDate)
+	assert.Equal(t, 0, manifest.Books)
+	assert.Equal(t, 1, len(manifest.Objects))
+	assert.Equal(t, "feed20240801.json", manifest.Objects[0].Name)
+	assert.Empty(t, manifest.Failed)
+}
+
+func TestArchiveRunRegardsExistingFeedsAsArchivedOnRerun(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	sourceFeeds := []*feeds.SourceFeed{
+		{Source: feeds.Source{Name: "hanmoto"}, Feed: &gofeed.Feed{PublishedParsed: &date}},
+	}
+	stub := UploaderStub{NoOverwrite: true}
+	books := &models.BookList{UploadDate: date, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "Book1", PubDate: date},
+	}}
+
+	archiveRun(&stub, sourceFeeds, books, false, uploader.DefaultPathTemplate, date)
+	archiveRun(&stub, sourceFeeds, books, false, uploader.DefaultPathTemplate, date.Add(time.Hour))
+
+	var names []string
+	for _, object := range stub.Objects {
+		names = append(names, object.ObjectName)
+	}
+	assert.Equal(t, []string{
+		"feed20240801.json",
+		"feed20240801.run-20240801T224200.books.jsonl",
+		"feed20240801.run-20240801T224200.books.csv",
+		"feed20240801.run-20240801T224200.manifest.json",
+		"feed20240801.run-20240801T234200.books.jsonl",
+		"feed20240801.run-20240801T234200.books.csv",
+		"feed20240801.run-20240801T234200.manifest.json",
+	}, names)
+
+	var manifest runManifest
+	assert.Nil(t, json.Unmarshal(stub.Objects[6].Binary, &manifest))
+	assert.Empty(t, manifest.Failed)
+	assert.Equal(t, 3, len(manifest.Objects))
+	assert.Equal(t, "feed20240801.json", manifest.Objects[0].Name)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tatamiya/new-books-notification/src/feeds"
+)
+
+const backfillDateLayout = "2006-01-02"
+
+// The longest range accepted at once, so that a typo in the dates does not flood the feed server.
+const maxBackfillDays = 366
+
+// nopNotifier discards the notifications, so that a backfill does not flood Slack with old books.
+type nopNotifier struct{}
+
+func (n nopNotifier) Post(string) error {
+	return nil
+}
+
+// runBackfill processes the books registered on each day from -from to -to,
+// recording them under the partition of that day.
+func runBackfill(args []string) int {
+
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	from := flags.String("from", "", "first date to backfill (YYYY-MM-DD)")
+	to := flags.String("to", "", "last date to backfill (YYYY-MM-DD), the same as -from by default")
+	notify := flags.Bool("notify", false, "notify favorite books to Slack")
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		log.Printf("Error in loading config: %s", err)
+		return exitSetupFailed
+	}
+	if err := cfg.ValidateRecorder(); err != nil {
+		log.Printf("Error in loading config: %s", err)
+		return exitSetupFailed
+	}
+
+	dates, err := backfillDates(*from, *to)
+	if err != nil {
+		log.Printf("Invalid backfill range: %s", err)
+		return exitUsage
+	}
+	for _, source := range cfg.Feeds {
+		if _, err := source.ForDate(dates[0]); err != nil {
+			log.Printf("Cannot backfill the feed sources: %s", err)
+			return exitSetupFailed
+		}
+	}
+
+	ctx := context.Background()
+	p, err := newPipeline(ctx, cfg, false, *notify)
+	if err != nil {
+		log.Println(err)
+		return exitSetupFailed
+	}
+	defer p.close()
+
+	total := &RunResult{}
+	for _, date := range dates {
+		day := date.Format(backfillDateLayout)
+
+		var sources []feeds.Source
+		for _, source := range cfg.Feeds {
+			datedSource, _ := source.ForDate(date)
+			sources = append(sources, datedSource)
+		}
+
+		_, bookList, err := fetchBookList(sources)
+		if bookList == nil {
+			log.Printf("Skipping %s: %s", day, err)
+			continue
+		}
+		if err != nil {
+			log.Printf("Could not get some of the feeds of %s: %s", day, err)
+		}
+		bookList.UploadDate = date
+
+		result := coreProcess(bookList, p.fetcher, p.recorder, p.filter, p.notifier, p.tracker, p.notifyUpdates, p.maxConcurrency)
+		log.Printf("Recorded %s of %s", result, day)
+		total.Add(result)
+	}
+
+	log.Printf("Backfilled %s", total)
+	return total.ExitCode(cfg.FailureThresholds.Recording, cfg.FailureThresholds.Notification)
+}
+
+// backfillDates lists the days from from to to in JST, both inclusive.
+func backfillDates(from string, to string) ([]time.Time, error) {
+
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		return nil, fmt.Errorf("cannot load timezone: %s", err)
+	}
+
+	if from == "" {
+		return nil, fmt.Errorf("-from is required")
+	}
+	fromDate, err := time.ParseInLocation(backfillDateLayout, from, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -from: %s", err)
+	}
+	toDate := fromDate
+	if to != "" {
+		toDate, err = time.ParseInLocation(backfillDateLayout, to, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -to: %s", err)
+		}
+	}
+	if toDate.Before(fromDate) {
+		return nil, fmt.Errorf("-to %s is before -from %s", to, from)
+	}
+
+	var dates []time.Time
+	for date := fromDate; !date.After(toDate); date = date.AddDate(0, 0, 1) {
+		dates = append(dates, date)
+		if len(dates) > maxBackfillDays {
+			return nil, fmt.Errorf("range from %s to %s is longer than %d days", from, to, maxBackfillDays)
+		}
+	}
+
+	return dates, nil
+}
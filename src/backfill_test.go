@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfillDatesListsEachDayInclusively(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+
+	actualDates, err := backfillDates("2024-02-28", "2024-03-01")
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, []time.Time{
+		time.Date(2024, time.February, 28, 0, 0, 0, 0, loc),
+		time.Date(2024, time.February, 29, 0, 0, 0, 0, loc),
+		time.Date(2024, time.March, 1, 0, 0, 0, 0, loc),
+	}, actualDates)
+}
+
+func TestBackfillDatesDefaultsToSingleDay(t *testing.T) {
+	actualDates, err := backfillDates("2024-08-01", "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(actualDates))
+	assert.Equal(t, "2024-08-01", actualDates[0].Format("2006-01-02"))
+}
+
+func TestBackfillDatesRejectsInvalidRange(t *testing.T) {
+	for _, testCase := range [][2]string{
+		{"", "2024-08-01"},
+		{"2024/08/01", ""},
+		{"2024-08-02", "2024-08-01"},
+		{"2020-01-01", "2024-01-01"},
+	} {
+		_, err := backfillDates(testCase[0], testCase[1])
+		assert.NotNil(t, err, "%v", testCase)
+	}
+}
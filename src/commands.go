@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tatamiya/new-books-notification/src/config"
+	"github.com/tatamiya/new-books-notification/src/details"
+	"github.com/tatamiya/new-books-notification/src/notifier"
+)
+
+type command struct {
+	run         func([]string) int
+	description string
+}
+
+var commands = map[string]command{
+	"run":             {runDaily, "process the books registered today (default)"},
+	"backfill":        {runBackfill, "process the books registered in a date range"},
+	"replay":          {runReplay, "process archived feeds again"},
+	"validate-filter": {runValidateFilter, "check the notification filters"},
+	"decode-ccode":    {runDecodeCcode, "decode C-codes with the code table"},
+	"lookup-isbn":     {runLookupISBN, "print the details of books in OpenBD"},
+}
+
+// runCommand runs the subcommand named by the first argument.
+// Without a subcommand, "run" is executed so that the deployed job keeps working without arguments.
+// It returns the exit code of the command.
+func runCommand(args []string) int {
+
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		printUsage()
+		return exitOK
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+		printUsage()
+		return exitUsage
+	}
+	return cmd.run(args)
+}
+
+func printUsage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: new-books-notification <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintln(os.Stderr, `Run "new-books-notification <command> -h" for the flags of each command.`)
+}
+
+// loadConfig parses the arguments of the command with the flags of the config,
+// and prints the resolved config after validating it.
+// The settings of the recorder and the archive are validated by the commands which open them.
+func loadConfig(flags *flag.FlagSet, args []string) (*config.Config, error) {
+
+	cfg, err := config.Load(flags, args, os.Getenv)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Config:\n%s", cfg)
+
+	return cfg, nil
+}
+
+// runValidateFilter checks the default filter and the filters of the feed sources,
+// e.g. before deploying changes of favorites.json.
+func runValidateFilter(args []string) int {
+
+	flags := flag.NewFlagSet("validate-filter", flag.ExitOnError)
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		log.Printf("Error in loading config: %s", err)
+		return exitSetupFailed
+	}
+
+	filterPaths := []string{cfg.Filter.Path}
+	for _, source := range cfg.Feeds {
+		if source.FilterPath != "" {
+			filterPaths = append(filterPaths, source.FilterPath)
+		}
+	}
+
+	valid := true
+	for _, filterPath := range filterPaths {
+		problems, err := notifier.CheckNotificationFilter(filterPath)
+		if err != nil {
+			problems = []string{err.Error()}
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s: OK\n", filterPath)
+			continue
+		}
+		valid = false
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", filterPath, problem)
+		}
+	}
+
+	if !valid {
+		return exitSetupFailed
+	}
+	return exitOK
+}
+
+// runDecodeCcode prints the subjects of the C-codes given as the arguments.
+func runDecodeCcode(args []string) int {
+
+	flags := flag.NewFlagSet("decode-ccode", flag.ExitOnError)
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		log.Printf("Error in loading config: %s", err)
+		return exitSetupFailed
+	}
+
+	decoder, err := details.NewSubjectDecoder(cfg.Fetcher.CcodeTablePath, cfg.Fetcher.StrictCcode)
+	if err != nil {
+		log.Printf("Error in loading SubjectDecoder: %s", err)
+		return exitSetupFailed
+	}
+
+	valid := true
+	for _, ccode := range flags.Args() {
+		decoded, err := decoder.Decode(ccode)
+		var unknownCodeErr *details.UnknownCodeError
+		if err != nil && !errors.As(err, &unknownCodeErr) {
+			fmt.Printf("%s: %s\n", ccode, err)
+			valid = false
+			continue
+		}
+		fmt.Printf("%s: 対象=%s 形態=%s 内容=%s\n", ccode, decoded.Target, decoded.Format, decoded.Content)
+		if err != nil {
+			fmt.Printf("%s: %s\n", ccode, err)
+			valid = false
+		}
+	}
+
+	if !valid {
+		return exitSetupFailed
+	}
+	return exitOK
+}
+
+// runLookupISBN prints the details fetched from OpenBD for the ISBNs given as the arguments.
+func runLookupISBN(args []string) int {
+
+	flags := flag.NewFlagSet("lookup-isbn", flag.ExitOnError)
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		log.Printf("Error in loading config: %s", err)
+		return exitSetupFailed
+	}
+
+	fetcher, err := newDetailFetcher(cfg)
+	if err != nil {
+		log.Println(err)
+		return exitSetupFailed
+	}
+
+	detailsByISBN, err := fetcher.FetchDetailInfoBatch(flags.Args())
+	if err != nil {
+		log.Printf("Cannot fetch data from OpenBD: %s", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	found := true
+	for _, isbn := range flags.Args() {
+		detailedInfo := detailsByISBN[isbn]
+		if detailedInfo == nil {
+			fmt.Printf("%s: not found\n", isbn)
+			found = false
+			continue
+		}
+		fmt.Printf("%s:\n", isbn)
+		if err := encoder.Encode(detailedInfo); err != nil {
+			log.Printf("Cannot print details of %s: %s", isbn, err)
+		}
+	}
+
+	if !found {
+		return exitSetupFailed
+	}
+	return exitOK
+}
@@ -1,5 +1,758 @@
 package config
 
-var FeedURL string = "https://www.hanmoto.com/ci/bd/search/hdt/%E6%96%B0%E3%81%97%E3%81%8F%E7%99%BB%E9%8C%B2%E3%81%95%E3%82%8C%E3%81%9F%E6%9C%AC/sdate/today/created/today/order/desc/vw/rss20"
-var CcodeJsonFilePath string = "./src/subject/ccode.json"
-var FilterSettingFilePath string = "./favorites.json"
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tatamiya/new-books-notification/src/details"
+	"github.com/tatamiya/new-books-notification/src/feeds"
+	"github.com/tatamiya/new-books-notification/src/uploader"
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultFeedURL string = "https://www.hanmoto.com/ci/bd/search/hdt/%E6%96%B0%E3%81%97%E3%81%8F%E7%99%BB%E9%8C%B2%E3%81%95%E3%82%8C%E3%81%9F%E6%9C%AC/sdate/today/created/today/order/desc/vw/rss20"
+
+// Config holds the settings of all the commands, in the structure of the YAML config file.
+// They are resolved from the defaults, the config file, the environment variables and the flags,
+// in increasing order of precedence.
+type Config struct {
+	// Feed sources watched in a run. They are fetched concurrently and a book found in several sources is processed once.
+	// A source with a filter uses it instead of the default filter.
+	Feeds    []feeds.Source `yaml:"feeds"`
+	Filter   FilterConfig   `yaml:"filter"`
+	Fetcher  FetcherConfig  `yaml:"fetcher"`
+	Notifier NotifierConfig `yaml:"notifier"`
+	Recorder RecorderConfig `yaml:"recorder"`
+	Uploader UploaderConfig `yaml:"uploader"`
+
+	// Ratios of failures in recording and notification above which a run exits with a failure code.
+	FailureThresholds FailureThresholdsConfig `yaml:"failure_thresholds"`
+}
+
+type FilterConfig struct {
+	Path string `yaml:"path"`
+}
+
+type FetcherConfig struct {
+	MaxConcurrency int `yaml:"max_concurrency"`
+
+	// Code tables overriding the ones embedded in the binary. Empty paths mean the embedded tables.
+	// When StrictCcode is true, C-codes missing in the table are reported in the log.
+	CcodeTablePath string `yaml:"ccode_table"`
+	NdcTablePath   string `yaml:"ndc_table"`
+	StrictCcode    bool   `yaml:"strict_ccode"`
+
+	OpenBD OpenBDConfig `yaml:"openbd"`
+	Cache  CacheConfig  `yaml:"cache"`
+}
+
+// Zero RequestsPerSecond means no rate limit.
+type OpenBDConfig struct {
+	BaseURL           string        `yaml:"base_url"`
+	Timeout           time.Duration `yaml:"timeout"`
+	UserAgent         string        `yaml:"user_agent"`
+	RequestsPerSecond float64       `yaml:"requests_per_second"`
+}
+
+// Cache of OpenBD responses. The cache is disabled when Path is empty.
+type CacheConfig struct {
+	Path string        `yaml:"path"`
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+type NotifierConfig struct {
+	Slack    SlackConfig    `yaml:"slack"`
+	Tracking TrackingConfig `yaml:"tracking"`
+}
+
+type SlackConfig struct {
+	WebhookURL        string  `yaml:"webhook_url"`
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+}
+
+// Deliveries of the notifications are tracked per ISBN in Table of the recorder backend, i.e. in the BigQuery dataset
+// of the recorder or in the SQLite or Postgres database, where it is created when it does not exist,
+// so that a book is not notified twice to the channel. Tracking is disabled when Table is empty, as by default,
+// so that the table is created only for the deployments opting in.
+// Notifications failed within RetryWindow are sent again by the following runs.
+type TrackingConfig struct {
+	Table       string        `yaml:"table"`
+	Channel     string        `yaml:"channel"`
+	RetryWindow time.Duration `yaml:"retry_window"`
+}
+
+// Type selects the backend of the records, "bigquery", "sqlite" or "postgres".
+// The notifications are tracked in the same backend.
+type RecorderConfig struct {
+	Type     string         `yaml:"type"`
+	BigQuery BigQueryConfig `yaml:"bigquery"`
+	SQLite   SQLiteConfig   `yaml:"sqlite"`
+	Postgres PostgresConfig `yaml:"postgres"`
+	Dedup    DedupConfig    `yaml:"dedup"`
+}
+
+// Books recorded within WindowDays up to the day of the run are not notified again.
+// A WindowDays of 1 checks the day of the run only, and a negative one checks all time.
+// With NotifyUpdates, a book recorded on an earlier day is notified as updated
+// when its important fields, such as the publication date, have changed.
+// It needs a WindowDays longer than 1, since earlier days are looked up within the window only.
+type DedupConfig struct {
+	WindowDays    int  `yaml:"window_days"`
+	NotifyUpdates bool `yaml:"notify_updates"`
+}
+
+// ProjectID is looked up in the metadata server when it is empty.
+// WriteMode is "insert" to append the records with the streaming inserter,
+// or "upsert" to merge them on ISBN so that the table holds one current row per book.
+type BigQueryConfig struct {
+	ProjectID string `yaml:"project"`
+	Dataset   string `yaml:"dataset"`
+	Table     string `yaml:"table"`
+	WriteMode string `yaml:"write_mode"`
+}
+
+type SQLiteConfig struct {
+	Path string `yaml:"path"`
+}
+
+// Zero values of the pool settings leave the defaults of database/sql.
+type PostgresConfig struct {
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// Type selects the backend of the feed archive, "gcs", "local" or "s3".
+// PathTemplate names the archived feeds, e.g. "{yyyy}/{mm}/feed{yyyymmdd}.json".
+type UploaderConfig struct {
+	Type         string      `yaml:"type"`
+	PathTemplate string      `yaml:"path_template"`
+	GCS          GCSConfig   `yaml:"gcs"`
+	Local        LocalConfig `yaml:"local"`
+	S3           S3Config    `yaml:"s3"`
+}
+
+// Checksum is "md5" or "crc32c" to have GCS verify the uploaded objects, or empty not to.
+// With NoOverwrite, an archived feed is never replaced, e.g. by a re-run of the day.
+type GCSConfig struct {
+	Bucket      string `yaml:"bucket"`
+	Checksum    string `yaml:"checksum"`
+	NoOverwrite bool   `yaml:"no_overwrite"`
+}
+
+// The files of the oldest runs, i.e. the book list and manifest with the feed of the day for its latest run, are removed
+// to keep MaxRuns runs in Directory; a MaxRuns of 0 keeps all.
+type LocalConfig struct {
+	Directory string `yaml:"directory"`
+	MaxRuns   int    `yaml:"max_runs"`
+}
+
+// Endpoint is the URL of an S3-compatible storage such as "https://s3.amazonaws.com" or "http://localhost:9000".
+// Empty keys read the credentials from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+}
+
+type FailureThresholdsConfig struct {
+	Recording    float64 `yaml:"recording"`
+	Notification float64 `yaml:"notification"`
+}
+
+func Default() *Config {
+	return &Config{
+		Feeds: []feeds.Source{
+			{Name: "hanmoto", URL: DefaultFeedURL},
+		},
+		Filter: FilterConfig{Path: "./favorites.json"},
+		Fetcher: FetcherConfig{
+			MaxConcurrency: 4,
+			StrictCcode:    true,
+			OpenBD: OpenBDConfig{
+				BaseURL:           "https://api.openbd.jp/v1/get",
+				Timeout:           30 * time.Second,
+				UserAgent:         details.DefaultUserAgent,
+				RequestsPerSecond: 5,
+			},
+			Cache: CacheConfig{TTL: 7 * 24 * time.Hour},
+		},
+		Recorder: RecorderConfig{
+			Type:     "bigquery",
+			BigQuery: BigQueryConfig{WriteMode: "insert"},
+			SQLite:   SQLiteConfig{Path: "./books.db"},
+			Postgres: PostgresConfig{MaxOpenConns: 4, MaxIdleConns: 2, ConnMaxLifetime: 30 * time.Minute},
+			Dedup:    DedupConfig{WindowDays: 1},
+		},
+		Notifier: NotifierConfig{
+			Slack: SlackConfig{RequestsPerSecond: 1},
+			Tracking: TrackingConfig{
+				Channel:     "slack",
+				RetryWindow: 7 * 24 * time.Hour,
+			},
+		},
+		Uploader: UploaderConfig{
+			Type:         "gcs",
+			PathTemplate: uploader.DefaultPathTemplate,
+			GCS:          GCSConfig{Checksum: "crc32c"},
+			Local:        LocalConfig{Directory: "./archive", MaxRuns: 90},
+			S3:           S3Config{Endpoint: "https://s3.amazonaws.com"},
+		},
+	}
+}
+
+// LoadFile overwrites the settings written in the YAML config file.
+// References to environment variables such as ${SLACK_WEBHOOK_URL} in the values are replaced by getenv.
+// Unknown keys are reported as errors so that typos do not silently fall back to the defaults.
+func (c *Config) LoadFile(path string, getenv func(string) string) error {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file %s: %s", path, err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("could not parse config file %s: %s", path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	if problems := checkKnownKeys(&root, reflect.TypeOf(*c), ""); len(problems) > 0 {
+		return fmt.Errorf("invalid config file %s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	if err := interpolateNode(&root, getenv); err != nil {
+		return fmt.Errorf("config file %s: %s", path, err)
+	}
+	if err := root.Decode(c); err != nil {
+		return fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+	return nil
+}
+
+// checkKnownKeys lists the keys which do not correspond to any field of t, with their lines.
+func checkKnownKeys(node *yaml.Node, t reflect.Type, path string) []string {
+
+	var problems []string
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			problems = append(problems, checkKnownKeys(child, t, path)...)
+		}
+	case yaml.SequenceNode:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for i, child := range node.Content {
+			problems = append(problems, checkKnownKeys(child, t.Elem(), fmt.Sprintf("%s[%d].", strings.TrimSuffix(path, "."), i))...)
+		}
+	case yaml.MappingNode:
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		fieldTypes := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if key == "" {
+				key = strings.ToLower(field.Name)
+			}
+			fieldTypes[key] = field.Type
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fieldTypes[key.Value]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("line %d: unknown key %s%s", key.Line, path, key.Value))
+				continue
+			}
+			problems = append(problems, checkKnownKeys(node.Content[i+1], fieldType, path+key.Value+".")...)
+		}
+	}
+	return problems
+}
+
+// ${VAR} is replaced by the variable, ${VAR:-default} falls back to default when the variable is empty,
+// and $$ escapes a dollar sign.
+var envReference = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+func interpolateNode(node *yaml.Node, getenv func(string) string) error {
+
+	if node.Kind == yaml.ScalarNode {
+		interpolated, err := interpolate(node.Value, getenv)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", node.Line, err)
+		}
+		if interpolated != node.Value {
+			// Let the interpolated value be resolved again, e.g. as a number.
+			node.Value = interpolated
+			node.Tag = ""
+			node.Style = 0
+		}
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := interpolateNode(child, getenv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func interpolate(value string, getenv func(string) string) (string, error) {
+
+	var missing []string
+	interpolated := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		if reference == "$$" {
+			return "$"
+		}
+		match := envReference.FindStringSubmatch(reference)
+		if v := getenv(match[1]); v != "" {
+			return v
+		}
+		if match[2] == "" {
+			missing = append(missing, match[1])
+		}
+		return match[3]
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return interpolated, nil
+}
+
+// ApplyEnv overwrites the settings given by the environment variables.
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+
+	for name, field := range map[string]*string{
+		"FILTER_SETTING_PATH":  &c.Filter.Path,
+		"CCODE_TABLE_PATH":     &c.Fetcher.CcodeTablePath,
+		"NDC_TABLE_PATH":       &c.Fetcher.NdcTablePath,
+		"OPENBD_BASE_URL":      &c.Fetcher.OpenBD.BaseURL,
+		"DETAIL_CACHE_PATH":    &c.Fetcher.Cache.Path,
+		"SLACK_WEBHOOK_URL":    &c.Notifier.Slack.WebhookURL,
+		"GCP_PROJECT_ID":       &c.Recorder.BigQuery.ProjectID,
+		"GCP_BIGQUERY_DATASET": &c.Recorder.BigQuery.Dataset,
+		"GCP_BIGQUERY_TABLE":   &c.Recorder.BigQuery.Table,
+		"BIGQUERY_WRITE_MODE":  &c.Recorder.BigQuery.WriteMode,
+		"RECORDER_TYPE":        &c.Recorder.Type,
+		"SQLITE_PATH":          &c.Recorder.SQLite.Path,
+		"POSTGRES_DSN":         &c.Recorder.Postgres.DSN,
+		"NOTIFICATION_TABLE":   &c.Notifier.Tracking.Table,
+		"GCS_BUCKET_NAME":      &c.Uploader.GCS.Bucket,
+		"UPLOADER_TYPE":        &c.Uploader.Type,
+		"UPLOAD_PATH_TEMPLATE": &c.Uploader.PathTemplate,
+		"LOCAL_ARCHIVE_DIR":    &c.Uploader.Local.Directory,
+		"S3_ENDPOINT":          &c.Uploader.S3.Endpoint,
+		"S3_REGION":            &c.Uploader.S3.Region,
+		"S3_BUCKET_NAME":       &c.Uploader.S3.Bucket,
+	} {
+		if v := getenv(name); v != "" {
+			*field = v
+		}
+	}
+
+	for name, field := range map[string]*int{
+		"MAX_CONCURRENCY":   &c.Fetcher.MaxConcurrency,
+		"DEDUP_WINDOW_DAYS": &c.Recorder.Dedup.WindowDays,
+	} {
+		if v := getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %s", name, v, err)
+			}
+			*field = n
+		}
+	}
+	for name, field := range map[string]*float64{
+		"OPENBD_REQUESTS_PER_SECOND": &c.Fetcher.OpenBD.RequestsPerSecond,
+		"SLACK_REQUESTS_PER_SECOND":  &c.Notifier.Slack.RequestsPerSecond,
+	} {
+		if v := getenv(name); v != "" {
+			rps, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %s", name, v, err)
+			}
+			*field = rps
+		}
+	}
+	for name, field := range map[string]*bool{
+		"STRICT_CCODE_DECODING":   &c.Fetcher.StrictCcode,
+		"NOTIFY_METADATA_UPDATES": &c.Recorder.Dedup.NotifyUpdates,
+	} {
+		if v := getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %s", name, v, err)
+			}
+			*field = b
+		}
+	}
+	if v := getenv("FEED_SOURCES"); v != "" {
+		sources, err := parseFeedSources(v)
+		if err != nil {
+			return fmt.Errorf("invalid FEED_SOURCES: %s", err)
+		}
+		c.Feeds = sources
+	}
+
+	return nil
+}
+
+// registerFlags binds the flags to the settings, with the current settings as their defaults.
+func (c *Config) registerFlags(fs *flag.FlagSet) {
+	fs.Var(&feedSourcesValue{sources: &c.Feeds}, "feed", `feed source as "name=url", repeatable (env FEED_SOURCES, separated by ";")`)
+	fs.StringVar(&c.Filter.Path, "filter", c.Filter.Path, "notification filter settings (env FILTER_SETTING_PATH)")
+	fs.StringVar(&c.Fetcher.CcodeTablePath, "ccode-table", c.Fetcher.CcodeTablePath, "C-code table overriding the embedded one (env CCODE_TABLE_PATH)")
+	fs.StringVar(&c.Fetcher.NdcTablePath, "ndc-table", c.Fetcher.NdcTablePath, "NDC table overriding the embedded one (env NDC_TABLE_PATH)")
+	fs.BoolVar(&c.Fetcher.StrictCcode, "strict-ccode", c.Fetcher.StrictCcode, "report C-codes missing in the table (env STRICT_CCODE_DECODING)")
+	fs.IntVar(&c.Fetcher.MaxConcurrency, "max-concurrency", c.Fetcher.MaxConcurrency, "number of books processed concurrently (env MAX_CONCURRENCY)")
+	fs.Float64Var(&c.Fetcher.OpenBD.RequestsPerSecond, "openbd-rps", c.Fetcher.OpenBD.RequestsPerSecond, "rate limit of OpenBD requests, 0 for no limit (env OPENBD_REQUESTS_PER_SECOND)")
+	fs.StringVar(&c.Fetcher.OpenBD.BaseURL, "openbd-url", c.Fetcher.OpenBD.BaseURL, "OpenBD endpoint (env OPENBD_BASE_URL)")
+	fs.DurationVar(&c.Fetcher.OpenBD.Timeout, "openbd-timeout", c.Fetcher.OpenBD.Timeout, "timeout of OpenBD requests")
+	fs.StringVar(&c.Fetcher.Cache.Path, "detail-cache", c.Fetcher.Cache.Path, "cache file of OpenBD responses, empty to disable (env DETAIL_CACHE_PATH)")
+	fs.DurationVar(&c.Fetcher.Cache.TTL, "detail-cache-ttl", c.Fetcher.Cache.TTL, "lifetime of cached OpenBD responses")
+	fs.StringVar(&c.Notifier.Slack.WebhookURL, "slack-webhook", c.Notifier.Slack.WebhookURL, "Slack incoming webhook URL (env SLACK_WEBHOOK_URL)")
+	fs.Float64Var(&c.Notifier.Slack.RequestsPerSecond, "slack-rps", c.Notifier.Slack.RequestsPerSecond, "rate limit of Slack posts, 0 for no limit (env SLACK_REQUESTS_PER_SECOND)")
+	fs.StringVar(&c.Notifier.Tracking.Table, "notification-table", c.Notifier.Tracking.Table, "table tracking the notifications in the recorder backend, empty to disable (env NOTIFICATION_TABLE)")
+	fs.StringVar(&c.Notifier.Tracking.Channel, "notification-channel", c.Notifier.Tracking.Channel, "name of the notified channel in the tracking table")
+	fs.DurationVar(&c.Notifier.Tracking.RetryWindow, "notification-retry-window", c.Notifier.Tracking.RetryWindow, "period in which failed notifications are retried")
+	fs.StringVar(&c.Recorder.Type, "recorder", c.Recorder.Type, `backend of the records, "bigquery", "sqlite" or "postgres" (env RECORDER_TYPE)`)
+	fs.StringVar(&c.Recorder.SQLite.Path, "sqlite-path", c.Recorder.SQLite.Path, "SQLite database of the records (env SQLITE_PATH)")
+	fs.StringVar(&c.Recorder.Postgres.DSN, "postgres-dsn", c.Recorder.Postgres.DSN, "Postgres connection string of the records (env POSTGRES_DSN)")
+	fs.StringVar(&c.Recorder.BigQuery.ProjectID, "project", c.Recorder.BigQuery.ProjectID, "GCP project, looked up in the metadata server if empty (env GCP_PROJECT_ID)")
+	fs.StringVar(&c.Recorder.BigQuery.Dataset, "dataset", c.Recorder.BigQuery.Dataset, "BigQuery dataset (env GCP_BIGQUERY_DATASET)")
+	fs.StringVar(&c.Recorder.BigQuery.Table, "table", c.Recorder.BigQuery.Table, "BigQuery table (env GCP_BIGQUERY_TABLE)")
+	fs.StringVar(&c.Recorder.BigQuery.WriteMode, "bigquery-write-mode", c.Recorder.BigQuery.WriteMode, `"insert" to append records or "upsert" to merge them on ISBN (env BIGQUERY_WRITE_MODE)`)
+	fs.IntVar(&c.Recorder.Dedup.WindowDays, "dedup-window-days", c.Recorder.Dedup.WindowDays, "days up to the run in which recorded books are not notified again, negative for all time (env DEDUP_WINDOW_DAYS)")
+	fs.BoolVar(&c.Recorder.Dedup.NotifyUpdates, "notify-updates", c.Recorder.Dedup.NotifyUpdates, "notify books recorded on an earlier day when their metadata is updated (env NOTIFY_METADATA_UPDATES)")
+	fs.StringVar(&c.Uploader.Type, "uploader", c.Uploader.Type, `backend of the feed archive, "gcs", "local" or "s3" (env UPLOADER_TYPE)`)
+	fs.StringVar(&c.Uploader.PathTemplate, "upload-path-template", c.Uploader.PathTemplate, "name of the archived feeds, e.g. {yyyy}/{mm}/feed{yyyymmdd}.json (env UPLOAD_PATH_TEMPLATE)")
+	fs.StringVar(&c.Uploader.GCS.Bucket, "bucket", c.Uploader.GCS.Bucket, "GCS bucket of the feed archive (env GCS_BUCKET_NAME)")
+	fs.StringVar(&c.Uploader.GCS.Checksum, "gcs-checksum", c.Uploader.GCS.Checksum, `checksum verified by GCS, "md5", "crc32c" or empty for none`)
+	fs.BoolVar(&c.Uploader.GCS.NoOverwrite, "gcs-no-overwrite", c.Uploader.GCS.NoOverwrite, "keep an archived feed in GCS instead of replacing it")
+	fs.StringVar(&c.Uploader.Local.Directory, "archive-dir", c.Uploader.Local.Directory, "local directory of the feed archive (env LOCAL_ARCHIVE_DIR)")
+	fs.IntVar(&c.Uploader.Local.MaxRuns, "archive-max-runs", c.Uploader.Local.MaxRuns, "number of runs kept in the local feed archive, 0 for all")
+	fs.StringVar(&c.Uploader.S3.Endpoint, "s3-endpoint", c.Uploader.S3.Endpoint, "URL of the S3-compatible storage of the feed archive (env S3_ENDPOINT)")
+	fs.StringVar(&c.Uploader.S3.Bucket, "s3-bucket", c.Uploader.S3.Bucket, "S3 bucket of the feed archive (env S3_BUCKET_NAME)")
+	fs.Float64Var(&c.FailureThresholds.Recording, "recording-failure-threshold", c.FailureThresholds.Recording, "ratio of failed records above which the run fails")
+	fs.Float64Var(&c.FailureThresholds.Notification, "notification-failure-threshold", c.FailureThresholds.Notification, "ratio of failed notifications above which the run fails")
+}
+
+// Load parses the arguments with fs, to which the flags of the settings and -config are added,
+// and resolves the settings from the defaults, the config file, the environment variables and the flags.
+// The config file is given by -config or CONFIG_FILE.
+func Load(fs *flag.FlagSet, args []string, getenv func(string) string) (*Config, error) {
+
+	flagged := Default()
+	flagged.registerFlags(fs)
+	configPath := fs.String("config", getenv("CONFIG_FILE"), "YAML config file (env CONFIG_FILE)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := Default()
+	if *configPath != "" {
+		if err := c.LoadFile(*configPath, getenv); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.ApplyEnv(getenv); err != nil {
+		return nil, err
+	}
+
+	// Only the flags given explicitly take precedence over the config file and the environment variables.
+	resolved := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	c.registerFlags(resolved)
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if resolved.Lookup(f.Name) == nil || flagErr != nil {
+			return
+		}
+		flagErr = resolved.Set(f.Name, f.Value.String())
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	return c, nil
+}
+
+func (c *Config) Validate() error {
+
+	var problems []string
+	if len(c.Feeds) == 0 {
+		problems = append(problems, "feeds: no feed source is configured")
+	}
+	names := make(map[string]bool)
+	for i, source := range c.Feeds {
+		if source.Name == "" || strings.ContainsAny(source.Name, "_/ ") {
+			problems = append(problems, fmt.Sprintf("feeds[%d].name: %q must be non-empty without '_', '/' or spaces", i, source.Name))
+		}
+		if names[source.Name] {
+			problems = append(problems, fmt.Sprintf("feeds[%d].name: %q is duplicated", i, source.Name))
+		}
+		names[source.Name] = true
+		if !isHTTPURL(source.URL) {
+			problems = append(problems, fmt.Sprintf("feeds[%d].url: invalid URL %q", i, source.URL))
+		}
+	}
+	if c.Filter.Path == "" {
+		problems = append(problems, "filter.path: empty")
+	}
+	if c.Fetcher.MaxConcurrency < 1 {
+		problems = append(problems, fmt.Sprintf("fetcher.max_concurrency: must be positive: %d", c.Fetcher.MaxConcurrency))
+	}
+	if !isHTTPURL(c.Fetcher.OpenBD.BaseURL) {
+		problems = append(problems, fmt.Sprintf("fetcher.openbd.base_url: invalid URL %q", c.Fetcher.OpenBD.BaseURL))
+	}
+	if c.Fetcher.OpenBD.Timeout <= 0 {
+		problems = append(problems, fmt.Sprintf("fetcher.openbd.timeout: must be positive: %s", c.Fetcher.OpenBD.Timeout))
+	}
+	if c.Fetcher.OpenBD.RequestsPerSecond < 0 {
+		problems = append(problems, "fetcher.openbd.requests_per_second: must not be negative")
+	}
+	if c.Notifier.Slack.RequestsPerSecond < 0 {
+		problems = append(problems, "notifier.slack.requests_per_second: must not be negative")
+	}
+	for _, threshold := range []struct {
+		name  string
+		value float64
+	}{
+		{"failure_thresholds.recording", c.FailureThresholds.Recording},
+		{"failure_thresholds.notification", c.FailureThresholds.Notification},
+	} {
+		if threshold.value < 0 || threshold.value > 1 {
+			problems = append(problems, fmt.Sprintf("%s: must be between 0 and 1: %g", threshold.name, threshold.value))
+		}
+	}
+	if c.Notifier.Slack.WebhookURL != "" && !isHTTPURL(c.Notifier.Slack.WebhookURL) {
+		problems = append(problems, "notifier.slack.webhook_url: invalid URL")
+	}
+	switch c.Recorder.Type {
+	case "bigquery":
+	case "sqlite":
+		if c.Recorder.SQLite.Path == "" {
+			problems = append(problems, "recorder.sqlite.path: empty")
+		}
+	case "postgres":
+		if c.Recorder.Postgres.DSN == "" {
+			problems = append(problems, "recorder.postgres.dsn: empty")
+		}
+		if c.Recorder.Postgres.MaxOpenConns < 0 || c.Recorder.Postgres.MaxIdleConns < 0 {
+			problems = append(problems, "recorder.postgres: numbers of connections must not be negative")
+		}
+		if c.Recorder.Postgres.ConnMaxLifetime < 0 {
+			problems = append(problems, "recorder.postgres.conn_max_lifetime: must not be negative")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("recorder.type: must be bigquery, sqlite or postgres: %q", c.Recorder.Type))
+	}
+	if c.Recorder.Dedup.NotifyUpdates && c.Recorder.Dedup.WindowDays >= 0 && c.Recorder.Dedup.WindowDays <= 1 {
+		problems = append(problems, fmt.Sprintf("recorder.dedup.notify_updates: needs window_days longer than 1 or negative: %d", c.Recorder.Dedup.WindowDays))
+	}
+	if c.Recorder.BigQuery.WriteMode != "insert" && c.Recorder.BigQuery.WriteMode != "upsert" {
+		problems = append(problems, fmt.Sprintf("recorder.bigquery.write_mode: must be insert or upsert: %q", c.Recorder.BigQuery.WriteMode))
+	}
+	if err := uploader.ValidatePathTemplate(c.Uploader.PathTemplate); err != nil {
+		problems = append(problems, fmt.Sprintf("uploader.path_template: %s: %q", err, c.Uploader.PathTemplate))
+	}
+	switch c.Uploader.Type {
+	case "gcs":
+		if c.Uploader.GCS.Checksum != "" && c.Uploader.GCS.Checksum != "md5" && c.Uploader.GCS.Checksum != "crc32c" {
+			problems = append(problems, fmt.Sprintf("uploader.gcs.checksum: must be md5, crc32c or empty: %q", c.Uploader.GCS.Checksum))
+		}
+	case "local":
+		if c.Uploader.Local.Directory == "" {
+			problems = append(problems, "uploader.local.directory: empty")
+		}
+		if c.Uploader.Local.MaxRuns < 0 {
+			problems = append(problems, fmt.Sprintf("uploader.local.max_runs: must not be negative: %d", c.Uploader.Local.MaxRuns))
+		}
+	case "s3":
+		if !isHTTPURL(c.Uploader.S3.Endpoint) {
+			problems = append(problems, fmt.Sprintf("uploader.s3.endpoint: invalid URL: %q", c.Uploader.S3.Endpoint))
+		}
+		if c.Uploader.S3.Bucket == "" {
+			problems = append(problems, "uploader.s3.bucket: empty")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("uploader.type: must be gcs, local or s3: %q", c.Uploader.Type))
+	}
+	if c.Notifier.Tracking.Table != "" {
+		if c.Notifier.Tracking.Channel == "" {
+			problems = append(problems, "notifier.tracking.channel: empty")
+		}
+		if c.Notifier.Tracking.RetryWindow <= 0 {
+			problems = append(problems, fmt.Sprintf("notifier.tracking.retry_window: must be positive: %s", c.Notifier.Tracking.RetryWindow))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// ValidateRecorder reports the settings of the recorder backend which have no defaults.
+// It is checked apart from Validate by the commands which open the recorder.
+func (c *Config) ValidateRecorder() error {
+
+	var problems []string
+	if c.Recorder.Type == "bigquery" {
+		if c.Recorder.BigQuery.Dataset == "" {
+			problems = append(problems, "recorder.bigquery.dataset: empty")
+		}
+		if c.Recorder.BigQuery.Table == "" {
+			problems = append(problems, "recorder.bigquery.table: empty")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// ValidateArchive reports the settings of the archive backend which have no defaults.
+// The archive is optional in a run, so that it is checked only by the commands which read it.
+func (c *Config) ValidateArchive() error {
+
+	if c.Uploader.Type == "gcs" && c.Uploader.GCS.Bucket == "" {
+		return fmt.Errorf("invalid config:\n  uploader.gcs.bucket: empty")
+	}
+	return nil
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// String lists the settings to be printed at startup, masking the secrets.
+func (c *Config) String() string {
+
+	var sources []string
+	for _, source := range c.Feeds {
+		s := fmt.Sprintf("%s=%s", source.Name, source.URL)
+		if source.FilterPath != "" {
+			s += fmt.Sprintf(" (filter: %s)", source.FilterPath)
+		}
+		sources = append(sources, s)
+	}
+
+	lines := []string{
+		fmt.Sprintf("feeds: %s", strings.Join(sources, ", ")),
+		fmt.Sprintf("filter: %s", c.Filter.Path),
+		fmt.Sprintf("ccode table: %s (strict: %t)", orEmbedded(c.Fetcher.CcodeTablePath), c.Fetcher.StrictCcode),
+		fmt.Sprintf("ndc table: %s", orEmbedded(c.Fetcher.NdcTablePath)),
+		fmt.Sprintf("max concurrency: %d", c.Fetcher.MaxConcurrency),
+		fmt.Sprintf("openbd: %s (timeout: %s, %g req/s)", c.Fetcher.OpenBD.BaseURL, c.Fetcher.OpenBD.Timeout, c.Fetcher.OpenBD.RequestsPerSecond),
+		fmt.Sprintf("detail cache: %s (ttl: %s)", orDisabled(c.Fetcher.Cache.Path), c.Fetcher.Cache.TTL),
+		fmt.Sprintf("slack: %s (%g req/s)", maskSecret(c.Notifier.Slack.WebhookURL), c.Notifier.Slack.RequestsPerSecond),
+		fmt.Sprintf("notification tracking: %s (channel: %s, retry window: %s)", orDisabled(c.Notifier.Tracking.Table), c.Notifier.Tracking.Channel, c.Notifier.Tracking.RetryWindow),
+		fmt.Sprintf("recorder: %s", c.Recorder.Type),
+		fmt.Sprintf("bigquery: %s.%s.%s (%s)", c.Recorder.BigQuery.ProjectID, c.Recorder.BigQuery.Dataset, c.Recorder.BigQuery.Table, c.Recorder.BigQuery.WriteMode),
+		fmt.Sprintf("sqlite: %s", c.Recorder.SQLite.Path),
+		fmt.Sprintf("postgres: %s (max open: %d, max idle: %d, max lifetime: %s)", maskSecret(c.Recorder.Postgres.DSN), c.Recorder.Postgres.MaxOpenConns, c.Recorder.Postgres.MaxIdleConns, c.Recorder.Postgres.ConnMaxLifetime),
+		fmt.Sprintf("dedup: %s (notify updates: %t)", dedupWindow(c.Recorder.Dedup.WindowDays), c.Recorder.Dedup.NotifyUpdates),
+		fmt.Sprintf("uploader: %s (path: %s)", c.Uploader.Type, c.Uploader.PathTemplate),
+		fmt.Sprintf("gcs bucket: %s (checksum: %s, no overwrite: %t)", c.Uploader.GCS.Bucket, orDisabled(c.Uploader.GCS.Checksum), c.Uploader.GCS.NoOverwrite),
+		fmt.Sprintf("local archive: %s (max runs: %d)", c.Uploader.Local.Directory, c.Uploader.Local.MaxRuns),
+		fmt.Sprintf("s3: %s/%s (region: %s, secret key: %s)", c.Uploader.S3.Endpoint, c.Uploader.S3.Bucket, c.Uploader.S3.Region, maskSecret(c.Uploader.S3.SecretAccessKey)),
+		fmt.Sprintf("failure thresholds: recording %g, notification %g", c.FailureThresholds.Recording, c.FailureThresholds.Notification),
+	}
+	return strings.Join(lines, "\n")
+}
+
+func orEmbedded(path string) string {
+	if path == "" {
+		return "(embedded)"
+	}
+	return path
+}
+
+func orDisabled(path string) string {
+	if path == "" {
+		return "(disabled)"
+	}
+	return path
+}
+
+func dedupWindow(days int) string {
+	switch {
+	case days < 0:
+		return "all time"
+	case days <= 1:
+		return "the day of the run"
+	default:
+		return fmt.Sprintf("%d days", days)
+	}
+}
+
+func maskSecret(secret string) string {
+	if secret == "" {
+		return "(not set)"
+	}
+	return "(set)"
+}
+
+// feedSourcesValue is the flag of the feed sources.
+// The first -feed replaces the configured sources and the following ones are appended.
+type feedSourcesValue struct {
+	sources *[]feeds.Source
+	set     bool
+}
+
+func (v *feedSourcesValue) String() string {
+	if v.sources == nil {
+		return ""
+	}
+	var specs []string
+	for _, source := range *v.sources {
+		specs = append(specs, source.Name+"="+source.URL)
+	}
+	return strings.Join(specs, ";")
+}
+
+func (v *feedSourcesValue) Set(spec string) error {
+	sources, err := parseFeedSources(spec)
+	if err != nil {
+		return err
+	}
+	if !v.set {
+		*v.sources = nil
+		v.set = true
+	}
+	*v.sources = append(*v.sources, sources...)
+	return nil
+}
+
+// parseFeedSources parses sources written as "name=url", separated by ";".
+func parseFeedSources(specs string) ([]feeds.Source, error) {
+	var sources []feeds.Source
+	for _, spec := range strings.Split(specs, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.Index(spec, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("feed source %q is not written as name=url", spec)
+		}
+		sources = append(sources, feeds.Source{Name: spec[:i], URL: spec[i+1:]})
+	}
+	return sources, nil
+}
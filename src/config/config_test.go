@@ -0,0 +1,215 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/new-books-notification/src/feeds"
+)
+
+func envStub(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
+
+func TestLoadLayersFlagsOverEnvOverConfigFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configFile := `
+feeds:
+  - name: publisher
+    url: https://example.com/publisher
+    filter: ./publisher.json
+fetcher:
+  max_concurrency: 2
+  openbd:
+    timeout: 10s
+    requests_per_second: 2
+recorder:
+  bigquery:
+    dataset: file_dataset
+    table: file_table
+`
+	assert.Nil(t, ioutil.WriteFile(configPath, []byte(configFile), 0644))
+
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	actualConfig, err := Load(fs,
+		[]string{"-config", configPath, "-max-concurrency", "8"},
+		envStub(map[string]string{
+			"MAX_CONCURRENCY":      "6",
+			"GCP_BIGQUERY_DATASET": "env_dataset",
+			"GCS_BUCKET_NAME":      "env_bucket",
+		}),
+	)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, []feeds.Source{
+		{Name: "publisher", URL: "https://example.com/publisher", FilterPath: "./publisher.json"},
+	}, actualConfig.Feeds)
+	assert.Equal(t, 8, actualConfig.Fetcher.MaxConcurrency)
+	assert.Equal(t, 2.0, actualConfig.Fetcher.OpenBD.RequestsPerSecond)
+	assert.Equal(t, 10*time.Second, actualConfig.Fetcher.OpenBD.Timeout)
+	assert.Equal(t, "env_dataset", actualConfig.Recorder.BigQuery.Dataset)
+	assert.Equal(t, "file_table", actualConfig.Recorder.BigQuery.Table)
+	assert.Equal(t, "./favorites.json", actualConfig.Filter.Path)
+	assert.Nil(t, actualConfig.Validate())
+}
+
+func TestLoadReplacesFeedSourcesByFlags(t *testing.T) {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	actualConfig, err := Load(fs,
+		[]string{"-feed", "publisher=https://example.com/publisher", "-feed", "genre=https://example.com/genre"},
+		envStub(map[string]string{"FEED_SOURCES": "env=https://example.com/env"}),
+	)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, []feeds.Source{
+		{Name: "publisher", URL: "https://example.com/publisher"},
+		{Name: "genre", URL: "https://example.com/genre"},
+	}, actualConfig.Feeds)
+}
+
+func TestLoadKeepsArgumentsOfCommand(t *testing.T) {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "")
+	_, err := Load(fs, []string{"-dry-run", "feed20240801.json"}, envStub(nil))
+
+	assert.Nil(t, err)
+	assert.True(t, *dryRun)
+	assert.EqualValues(t, []string{"feed20240801.json"}, fs.Args())
+}
+
+func TestLoadFailsWithInvalidEnv(t *testing.T) {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	_, err := Load(fs, nil, envStub(map[string]string{"MAX_CONCURRENCY": "many"}))
+
+	assert.NotNil(t, err)
+}
+
+func TestValidateReportsInvalidSettings(t *testing.T) {
+	invalidConfig := Default()
+	invalidConfig.Feeds = []feeds.Source{
+		{Name: "hanmoto", URL: "https://example.com/feed"},
+		{Name: "hanmoto", URL: "not a url"},
+	}
+	invalidConfig.Fetcher.MaxConcurrency = 0
+
+	assert.Nil(t, validConfig().Validate())
+	assert.NotNil(t, invalidConfig.Validate())
+}
+
+// validConfig is the default config with the settings which have no defaults.
+func validConfig() *Config {
+	c := Default()
+	c.Recorder.BigQuery.Dataset = "books"
+	c.Recorder.BigQuery.Table = "new_books"
+	c.Uploader.GCS.Bucket = "feeds"
+	return c
+}
+
+func TestValidateLeavesBackendsToTheCommandsOpeningThem(t *testing.T) {
+	assert.Nil(t, Default().Validate())
+
+	err := Default().ValidateRecorder()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "recorder.bigquery.dataset: empty")
+	assert.Contains(t, err.Error(), "recorder.bigquery.table: empty")
+	assert.Nil(t, validConfig().ValidateRecorder())
+
+	err = Default().ValidateArchive()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "uploader.gcs.bucket: empty")
+	assert.Nil(t, validConfig().ValidateArchive())
+}
+
+func TestValidateRejectsNotifyUpdatesWithinTheDay(t *testing.T) {
+	c := validConfig()
+	c.Recorder.Dedup.NotifyUpdates = true
+	assert.NotNil(t, c.Validate())
+
+	c.Recorder.Dedup.WindowDays = 30
+	assert.Nil(t, c.Validate())
+
+	c.Recorder.Dedup.WindowDays = -1
+	assert.Nil(t, c.Validate())
+}
+
+func TestValidateReportsIncompleteUploader(t *testing.T) {
+	c := validConfig()
+	c.Uploader.Type = "s3"
+	assert.NotNil(t, c.Validate())
+
+	c.Uploader.S3.Bucket = "feeds"
+	assert.Nil(t, c.Validate())
+
+	c.Uploader.Type = "ftp"
+	assert.NotNil(t, c.Validate())
+}
+
+func TestStringMasksWebhookURL(t *testing.T) {
+	c := Default()
+	c.Notifier.Slack.WebhookURL = "https://hooks.slack.com/services/SECRET"
+
+	assert.NotContains(t, c.String(), "SECRET")
+}
+
+func TestLoadFileInterpolatesEnvironmentVariables(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configFile := `
+notifier:
+  slack:
+    webhook_url: ${SLACK_WEBHOOK_URL}
+recorder:
+  bigquery:
+    dataset: ${DATASET:-books}
+    table: ${TEAM}_books
+uploader:
+  gcs:
+    bucket: price$$
+fetcher:
+  max_concurrency: "${MAX_CONCURRENCY}"
+`
+	assert.Nil(t, ioutil.WriteFile(configPath, []byte(configFile), 0644))
+
+	c := Default()
+	err := c.LoadFile(configPath, envStub(map[string]string{
+		"SLACK_WEBHOOK_URL": "https://hooks.slack.com/services/SECRET",
+		"TEAM":              "science",
+		"MAX_CONCURRENCY":   "8",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "https://hooks.slack.com/services/SECRET", c.Notifier.Slack.WebhookURL)
+	assert.Equal(t, "books", c.Recorder.BigQuery.Dataset)
+	assert.Equal(t, "science_books", c.Recorder.BigQuery.Table)
+	assert.Equal(t, "price$", c.Uploader.GCS.Bucket)
+	assert.Equal(t, 8, c.Fetcher.MaxConcurrency)
+	assert.Equal(t, "./favorites.json", c.Filter.Path)
+}
+
+func TestLoadFileFailsFast(t *testing.T) {
+	for name, configFile := range map[string]string{
+		"missing variable": "notifier:\n  slack:\n    webhook_url: ${SLACK_WEBHOOK_URL}\n",
+		"unknown key":      "fetcher:\n  max_concurency: 2\n",
+		"wrong type":       "fetcher:\n  max_concurrency: many\n",
+		"broken yaml":      "feeds: [\n",
+	} {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		assert.Nil(t, ioutil.WriteFile(configPath, []byte(configFile), 0644))
+
+		err := Default().LoadFile(configPath, envStub(nil))
+
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestDefaultDisablesNotificationTracking(t *testing.T) {
+	c := Default()
+
+	assert.Equal(t, "", c.Notifier.Tracking.Table)
+	assert.Nil(t, c.Validate())
+}
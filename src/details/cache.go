@@ -0,0 +1,285 @@
+package details
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Fetcher is the interface wrapped by CachedDetailsFetcher.
+type Fetcher interface {
+	FetchDetailInfo(string) (*DetailedInformation, error)
+}
+
+// BatchFetcher is implemented by fetchers which can look up several ISBNs at once.
+type BatchFetcher interface {
+	FetchDetailInfoBatch([]string) (map[string]*DetailedInformation, error)
+}
+
+// cacheVersion is raised when DetailedInformation gains fields,
+// so that entries cached without them, e.g. the price and the NDC, are fetched again.
+const cacheVersion = 1
+
+type CacheEntry struct {
+	Version  int                  `json:"version"`
+	ISBN     string               `json:"isbn"`
+	Details  *DetailedInformation `json:"details"`
+	CachedAt time.Time            `json:"cached_at"`
+}
+
+type CacheStore interface {
+	Get(isbn string) (*CacheEntry, bool)
+	Put(entry *CacheEntry) error
+}
+
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// CachedDetailsFetcher serves details from the cache store
+// and asks the wrapped fetcher only for ISBNs which are missing or older than the TTL.
+// Empty results are not cached so that books registered later in OpenBD are looked up again.
+type CachedDetailsFetcher struct {
+	hits    int64
+	misses  int64
+	fetcher Fetcher
+	store   CacheStore
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+// NewCachedDetailsFetcher wraps the fetcher with the cache store.
+// Zero or a negative ttl keeps cached entries forever.
+func NewCachedDetailsFetcher(fetcher Fetcher, store CacheStore, ttl time.Duration) *CachedDetailsFetcher {
+	return &CachedDetailsFetcher{
+		fetcher: fetcher,
+		store:   store,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+func (c *CachedDetailsFetcher) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+	}
+}
+
+func (c *CachedDetailsFetcher) lookup(isbn string) (*DetailedInformation, bool) {
+	entry, ok := c.store.Get(isbn)
+	if !ok || entry.Version != cacheVersion || (c.ttl > 0 && c.now().Sub(entry.CachedAt) > c.ttl) {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return entry.Details, true
+}
+
+func (c *CachedDetailsFetcher) save(isbn string, detailedInfo *DetailedInformation) {
+	if detailedInfo == nil {
+		return
+	}
+	err := c.store.Put(&CacheEntry{Version: cacheVersion, ISBN: isbn, Details: detailedInfo, CachedAt: c.now()})
+	if err != nil {
+		log.Printf("Cannot cache details of %s: %s", isbn, err)
+	}
+}
+
+func (c *CachedDetailsFetcher) FetchDetailInfo(isbn string) (*DetailedInformation, error) {
+
+	if detailedInfo, ok := c.lookup(isbn); ok {
+		return detailedInfo, nil
+	}
+
+	detailedInfo, err := c.fetcher.FetchDetailInfo(isbn)
+	if err != nil {
+		return nil, err
+	}
+	c.save(isbn, detailedInfo)
+
+	return detailedInfo, nil
+}
+
+// FetchDetailInfoBatch serves cached ISBNs from the store and fetches the rest,
+// in batch when the wrapped fetcher supports it.
+func (c *CachedDetailsFetcher) FetchDetailInfoBatch(isbns []string) (map[string]*DetailedInformation, error) {
+
+	detailsByISBN := make(map[string]*DetailedInformation, len(isbns))
+	var missedISBNs []string
+	for _, isbn := range isbns {
+		if detailedInfo, ok := c.lookup(isbn); ok {
+			detailsByISBN[isbn] = detailedInfo
+		} else {
+			missedISBNs = append(missedISBNs, isbn)
+		}
+	}
+	if len(missedISBNs) == 0 {
+		return detailsByISBN, nil
+	}
+
+	var fetchErr error
+	if batchFetcher, ok := c.fetcher.(BatchFetcher); ok {
+		var fetched map[string]*DetailedInformation
+		fetched, fetchErr = batchFetcher.FetchDetailInfoBatch(missedISBNs)
+		for isbn, detailedInfo := range fetched {
+			detailsByISBN[isbn] = detailedInfo
+			c.save(isbn, detailedInfo)
+		}
+	} else {
+		numFailed := 0
+		for _, isbn := range missedISBNs {
+			detailedInfo, err := c.fetcher.FetchDetailInfo(isbn)
+			if err != nil {
+				numFailed++
+				fetchErr = fmt.Errorf("failed in fetching %d of %d ISBN(s): %s", numFailed, len(missedISBNs), err)
+				continue
+			}
+			detailsByISBN[isbn] = detailedInfo
+			c.save(isbn, detailedInfo)
+		}
+	}
+
+	return detailsByISBN, fetchErr
+}
+
+type MemoryCacheStore struct {
+	mu      sync.RWMutex
+	entries map[string]*CacheEntry
+}
+
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{entries: map[string]*CacheEntry{}}
+}
+
+func (s *MemoryCacheStore) Get(isbn string) (*CacheEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[isbn]
+	return entry, ok
+}
+
+func (s *MemoryCacheStore) Put(entry *CacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.ISBN] = entry
+	return nil
+}
+
+// JSONLinesCacheStore keeps the cache in memory and appends every new entry to a JSON Lines file,
+// so that the cache survives restarts and crashes.
+// When the file is opened, the latest entry of each ISBN is loaded and the file is compacted.
+type JSONLinesCacheStore struct {
+	memory *MemoryCacheStore
+	mu     sync.Mutex
+	file   *os.File
+}
+
+// OpenJSONLinesCacheStore loads the cache file, dropping entries cached more than retention ago.
+// Zero or a negative retention keeps all the entries.
+func OpenJSONLinesCacheStore(path string, retention time.Duration) (*JSONLinesCacheStore, error) {
+
+	memory := NewMemoryCacheStore()
+	if err := loadCacheFile(path, retention, memory); err != nil {
+		return nil, err
+	}
+	if err := writeCacheFile(path, memory); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open cache file %s: %s", path, err)
+	}
+
+	return &JSONLinesCacheStore{
+		memory: memory,
+		file:   file,
+	}, nil
+}
+
+func loadCacheFile(path string, retention time.Duration, memory *MemoryCacheStore) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not open cache file %s: %s", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		var entry CacheEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line may be cut off when the process crashed while writing it.
+			log.Printf("Skipping broken cache entry at %s:%d: %s", path, lineNum, err)
+			continue
+		}
+		if retention > 0 && time.Since(entry.CachedAt) > retention {
+			continue
+		}
+		memory.Put(&entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read cache file %s: %s", path, err)
+	}
+	return nil
+}
+
+func writeCacheFile(path string, memory *MemoryCacheStore) error {
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not compact cache file %s: %s", path, err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	w := bufio.NewWriter(tempFile)
+	encoder := json.NewEncoder(w)
+	for _, entry := range memory.entries {
+		if err := encoder.Encode(entry); err != nil {
+			tempFile.Close()
+			return fmt.Errorf("could not compact cache file %s: %s", path, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("could not compact cache file %s: %s", path, err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("could not compact cache file %s: %s", path, err)
+	}
+
+	return os.Rename(tempFile.Name(), path)
+}
+
+func (s *JSONLinesCacheStore) Get(isbn string) (*CacheEntry, bool) {
+	return s.memory.Get(isbn)
+}
+
+func (s *JSONLinesCacheStore) Put(entry *CacheEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("could not encode cache entry: %s", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write cache entry: %s", err)
+	}
+
+	return s.memory.Put(entry)
+}
+
+func (s *JSONLinesCacheStore) Close() error {
+	return s.file.Close()
+}
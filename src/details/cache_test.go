@@ -0,0 +1,175 @@
+package details
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fetcherStub struct {
+	Details      map[string]*DetailedInformation
+	IsError      bool
+	Queries      []string
+	BatchQueries [][]string
+}
+
+func (f *fetcherStub) FetchDetailInfo(isbn string) (*DetailedInformation, error) {
+	f.Queries = append(f.Queries, isbn)
+	if f.IsError {
+		return nil, fmt.Errorf("OpenBD request failed!")
+	}
+	return f.Details[isbn], nil
+}
+
+type batchFetcherStub struct {
+	fetcherStub
+}
+
+func (f *batchFetcherStub) FetchDetailInfoBatch(isbns []string) (map[string]*DetailedInformation, error) {
+	f.BatchQueries = append(f.BatchQueries, isbns)
+	if f.IsError {
+		return map[string]*DetailedInformation{}, fmt.Errorf("OpenBD request failed!")
+	}
+	detailsByISBN := map[string]*DetailedInformation{}
+	for _, isbn := range isbns {
+		detailsByISBN[isbn] = f.Details[isbn]
+	}
+	return detailsByISBN, nil
+}
+
+func TestCachedFetcherServesRepeatedLookupsFromCache(t *testing.T) {
+	testFetcher := fetcherStub{
+		Details: map[string]*DetailedInformation{
+			"1111111111111": {Author: "tatamiya tamiya／著"},
+		},
+	}
+	cachedFetcher := NewCachedDetailsFetcher(&testFetcher, NewMemoryCacheStore(), time.Hour)
+
+	first, err := cachedFetcher.FetchDetailInfo("1111111111111")
+	assert.Nil(t, err)
+	second, err := cachedFetcher.FetchDetailInfo("1111111111111")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "tatamiya tamiya／著", first.Author)
+	assert.Equal(t, "tatamiya tamiya／著", second.Author)
+	assert.EqualValues(t, []string{"1111111111111"}, testFetcher.Queries)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1}, cachedFetcher.Stats())
+}
+
+func TestCachedFetcherRefetchesExpiredEntries(t *testing.T) {
+	testFetcher := fetcherStub{
+		Details: map[string]*DetailedInformation{
+			"1111111111111": {Author: "tatamiya tamiya／著"},
+		},
+	}
+	cachedFetcher := NewCachedDetailsFetcher(&testFetcher, NewMemoryCacheStore(), time.Hour)
+	now := time.Date(2024, time.August, 1, 0, 0, 0, 0, time.UTC)
+	cachedFetcher.now = func() time.Time { return now }
+
+	_, _ = cachedFetcher.FetchDetailInfo("1111111111111")
+	now = now.Add(2 * time.Hour)
+	_, _ = cachedFetcher.FetchDetailInfo("1111111111111")
+
+	assert.Equal(t, 2, len(testFetcher.Queries))
+	assert.Equal(t, CacheStats{Hits: 0, Misses: 2}, cachedFetcher.Stats())
+}
+
+func TestCachedFetcherRefetchesEntriesOfOtherVersion(t *testing.T) {
+	testFetcher := fetcherStub{
+		Details: map[string]*DetailedInformation{
+			"1111111111111": {Author: "tatamiya tamiya／著", Price: 1800},
+		},
+	}
+	store := NewMemoryCacheStore()
+	assert.Nil(t, store.Put(&CacheEntry{ISBN: "1111111111111", Details: &DetailedInformation{Author: "tatamiya tamiya／著"}, CachedAt: time.Now()}))
+	cachedFetcher := NewCachedDetailsFetcher(&testFetcher, store, 0)
+
+	detailedInfo, err := cachedFetcher.FetchDetailInfo("1111111111111")
+	assert.Nil(t, err)
+	assert.Equal(t, 1800, detailedInfo.Price)
+	_, _ = cachedFetcher.FetchDetailInfo("1111111111111")
+
+	assert.Equal(t, 1, len(testFetcher.Queries))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1}, cachedFetcher.Stats())
+}
+
+func TestCachedFetcherDoesNotCacheEmptyOrFailedResults(t *testing.T) {
+	testFetcher := fetcherStub{IsError: true}
+	cachedFetcher := NewCachedDetailsFetcher(&testFetcher, NewMemoryCacheStore(), time.Hour)
+
+	_, err := cachedFetcher.FetchDetailInfo("1111111111111")
+	assert.NotNil(t, err)
+
+	testFetcher.IsError = false
+	detailedInfo, err := cachedFetcher.FetchDetailInfo("1111111111111")
+	assert.Nil(t, err)
+	assert.Nil(t, detailedInfo)
+
+	_, _ = cachedFetcher.FetchDetailInfo("1111111111111")
+	assert.Equal(t, 3, len(testFetcher.Queries))
+}
+
+func TestCachedFetcherFetchesOnlyMissesInBatch(t *testing.T) {
+	testFetcher := batchFetcherStub{
+		fetcherStub: fetcherStub{
+			Details: map[string]*DetailedInformation{
+				"1111111111111": {Author: "author1"},
+				"2222222222222": {Author: "author2"},
+			},
+		},
+	}
+	cachedFetcher := NewCachedDetailsFetcher(&testFetcher, NewMemoryCacheStore(), time.Hour)
+
+	_, _ = cachedFetcher.FetchDetailInfo("1111111111111")
+	actualDetails, err := cachedFetcher.FetchDetailInfoBatch([]string{"1111111111111", "2222222222222", "3333333333333"})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, [][]string{{"2222222222222", "3333333333333"}}, testFetcher.BatchQueries)
+	assert.Equal(t, "author1", actualDetails["1111111111111"].Author)
+	assert.Equal(t, "author2", actualDetails["2222222222222"].Author)
+	assert.Nil(t, actualDetails["3333333333333"])
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 3}, cachedFetcher.Stats())
+}
+
+func TestJSONLinesCacheStoreSurvivesReopening(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.jsonl")
+	cachedAt := time.Now().Truncate(time.Second)
+
+	store, err := OpenJSONLinesCacheStore(cachePath, time.Hour)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Put(&CacheEntry{ISBN: "1111111111111", Details: &DetailedInformation{Author: "old"}, CachedAt: cachedAt}))
+	assert.Nil(t, store.Put(&CacheEntry{ISBN: "1111111111111", Details: &DetailedInformation{Author: "new"}, CachedAt: cachedAt}))
+	assert.Nil(t, store.Put(&CacheEntry{ISBN: "2222222222222", Details: &DetailedInformation{Author: "expired"}, CachedAt: cachedAt.Add(-2 * time.Hour)}))
+	assert.Nil(t, store.Close())
+
+	reopenedStore, err := OpenJSONLinesCacheStore(cachePath, time.Hour)
+	assert.Nil(t, err)
+	defer reopenedStore.Close()
+
+	entry, ok := reopenedStore.Get("1111111111111")
+	assert.True(t, ok)
+	assert.Equal(t, "new", entry.Details.Author)
+	_, ok = reopenedStore.Get("2222222222222")
+	assert.False(t, ok)
+}
+
+func TestJSONLinesCacheStoreSkipsBrokenLines(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.jsonl")
+	content := `{"isbn": "1111111111111", "details": {"Author": "author1"}, "cached_at": "2999-01-01T00:00:00Z"}
+{"isbn": "2222222222222", "details": {"Aut`
+	assert.Nil(t, ioutil.WriteFile(cachePath, []byte(content), 0644))
+
+	store, err := OpenJSONLinesCacheStore(cachePath, 0)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	entry, ok := store.Get("1111111111111")
+	assert.True(t, ok)
+	assert.Equal(t, "author1", entry.Details.Author)
+	_, ok = store.Get("2222222222222")
+	assert.False(t, ok)
+}
@@ -1,16 +1,28 @@
 package details
 
 import (
+	_ "embed"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"sort"
 	"strconv"
+	"strings"
 )
 
+// ccodeTableVersion is the version of the ccode.json format this decoder understands.
+const ccodeTableVersion = 1
+
+//go:embed ccode.json
+var defaultCcodeTable []byte
+
 type SubjectDecoder struct {
+	Version int               `json:"version"`
 	Taishou map[string]string `json:"taishou"`
 	Keitai  map[string]string `json:"keitai"`
 	Naiyou  map[string]string `json:"naiyou"`
+
+	strict bool
 }
 
 type DecodedSubject struct {
@@ -20,6 +32,19 @@ type DecodedSubject struct {
 	Content string
 }
 
+// UnknownCodeError is returned in the strict mode when a part of a C-code is missing in the table.
+type UnknownCodeError struct {
+	Ccode string
+	Parts []string
+}
+
+func (e *UnknownCodeError) Error() string {
+	return fmt.Sprintf("unknown Ccode %s: %s not found in the code table", e.Ccode, strings.Join(e.Parts, ", "))
+}
+
+// Decode decodes a 4-digit C-code.
+// Parts missing in the table are decoded to empty strings.
+// In the strict mode, an *UnknownCodeError is returned for them together with the partially decoded subject.
 func (s *SubjectDecoder) Decode(ccode string) (*DecodedSubject, error) {
 
 	if _, err := strconv.Atoi(ccode); err != nil {
@@ -29,26 +54,97 @@ func (s *SubjectDecoder) Decode(ccode string) (*DecodedSubject, error) {
 		return nil, fmt.Errorf("invalid Ccode! %s is not 4 digits", ccode)
 	}
 	chars := []rune(ccode)
-	target := s.Taishou[string(chars[0])]
-	format := s.Keitai[string(chars[1])]
-	content := s.Naiyou[string(chars[2:])]
+	target, targetFound := s.Taishou[string(chars[0])]
+	format, formatFound := s.Keitai[string(chars[1])]
+	content, contentFound := s.Naiyou[string(chars[2:])]
 
-	return &DecodedSubject{
+	decoded := &DecodedSubject{
 		ccode, target, format, content,
-	}, nil
+	}
+
+	if s.strict {
+		var unknownParts []string
+		if !targetFound {
+			unknownParts = append(unknownParts, "taishou")
+		}
+		if !formatFound {
+			unknownParts = append(unknownParts, "keitai")
+		}
+		if !contentFound {
+			unknownParts = append(unknownParts, "naiyou")
+		}
+		if len(unknownParts) > 0 {
+			return decoded, &UnknownCodeError{Ccode: ccode, Parts: unknownParts}
+		}
+	}
+
+	return decoded, nil
 }
 
-func NewSubjectDecoder(codeTablePath string) (*SubjectDecoder, error) {
+// NewSubjectDecoder loads the C-code table from codeTablePath,
+// or the table embedded in the binary if codeTablePath is empty.
+func NewSubjectDecoder(codeTablePath string, strict bool) (*SubjectDecoder, error) {
 
-	var decoder SubjectDecoder
-	ccodeData, ioErr := ioutil.ReadFile(codeTablePath)
-	if ioErr != nil {
-		return nil, fmt.Errorf("could not read ccode.json!: %s", ioErr)
+	ccodeData := defaultCcodeTable
+	if codeTablePath != "" {
+		var ioErr error
+		ccodeData, ioErr = ioutil.ReadFile(codeTablePath)
+		if ioErr != nil {
+			return nil, fmt.Errorf("could not read ccode.json!: %s", ioErr)
+		}
 	}
+
+	var decoder SubjectDecoder
 	jsonErr := json.Unmarshal(ccodeData, &decoder)
 	if jsonErr != nil {
 		return nil, fmt.Errorf("could not unmarshal json data!: %s", jsonErr)
 	}
+	if err := decoder.validate(); err != nil {
+		return nil, fmt.Errorf("invalid C-code table: %s", err)
+	}
+	decoder.strict = strict
 
 	return &decoder, nil
 }
+
+func (s *SubjectDecoder) validate() error {
+
+	if s.Version != ccodeTableVersion {
+		return fmt.Errorf("unsupported version %d (expected %d)", s.Version, ccodeTableVersion)
+	}
+
+	var problems []string
+	for _, section := range []struct {
+		name      string
+		codes     map[string]string
+		numDigits int
+		complete  bool
+	}{
+		{"taishou", s.Taishou, 1, true},
+		{"keitai", s.Keitai, 1, true},
+		{"naiyou", s.Naiyou, 2, false},
+	} {
+		if len(section.codes) == 0 {
+			problems = append(problems, fmt.Sprintf("%s is empty", section.name))
+			continue
+		}
+		for code := range section.codes {
+			if _, err := strconv.Atoi(code); err != nil || len(code) != section.numDigits {
+				problems = append(problems, fmt.Sprintf("%s has an invalid code %q", section.name, code))
+			}
+		}
+		if section.complete {
+			for digit := 0; digit <= 9; digit++ {
+				if _, ok := section.codes[strconv.Itoa(digit)]; !ok {
+					problems = append(problems, fmt.Sprintf("%s misses the code %d", section.name, digit))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package details
 
 import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -65,9 +68,57 @@ func TestDecodedResultIsEmptyWhenNotFound(t *testing.T) {
 }
 
 func TestNewSubjectDecoder(t *testing.T) {
-	decoder, err := NewSubjectDecoder("./ccode.json")
+	decoder, err := NewSubjectDecoder("./ccode.json", false)
 	assert.Nil(t, err)
 	assert.EqualValues(t, "一般", decoder.Taishou["0"])
 	assert.EqualValues(t, "単行本", decoder.Keitai["0"])
 	assert.EqualValues(t, "総記", decoder.Naiyou["00"])
 }
+
+func TestNewSubjectDecoderLoadsEmbeddedTableByDefault(t *testing.T) {
+	decoder, err := NewSubjectDecoder("", false)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, decoder.Version)
+	assert.EqualValues(t, "一般", decoder.Taishou["0"])
+	assert.EqualValues(t, "総記", decoder.Naiyou["00"])
+}
+
+func TestStrictDecoderReportsUnknownCode(t *testing.T) {
+	strictDecoder := testDecoder
+	strictDecoder.strict = true
+
+	expectedDecoded := DecodedSubject{
+		Ccode:   "2049",
+		Target:  "",
+		Format:  "単行本",
+		Content: "",
+	}
+
+	actualDecoded, err := strictDecoder.Decode("2049")
+
+	var unknownCodeErr *UnknownCodeError
+	assert.True(t, errors.As(err, &unknownCodeErr))
+	assert.EqualValues(t, []string{"taishou", "naiyou"}, unknownCodeErr.Parts)
+	assert.EqualValues(t, expectedDecoded, *actualDecoded)
+
+	_, err = strictDecoder.Decode("0040")
+	assert.Nil(t, err)
+}
+
+func TestNewSubjectDecoderRejectsInvalidTable(t *testing.T) {
+	completeDigits := `{"0": "a", "1": "a", "2": "a", "3": "a", "4": "a", "5": "a", "6": "a", "7": "a", "8": "a", "9": "a"}`
+
+	for name, table := range map[string]string{
+		"missing version":  `{"taishou": ` + completeDigits + `, "keitai": ` + completeDigits + `, "naiyou": {"00": "総記"}}`,
+		"invalid key":      `{"version": 1, "taishou": ` + completeDigits + `, "keitai": ` + completeDigits + `, "naiyou": {"0": "総記"}}`,
+		"incomplete digit": `{"version": 1, "taishou": {"0": "一般"}, "keitai": ` + completeDigits + `, "naiyou": {"00": "総記"}}`,
+		"empty section":    `{"version": 1, "taishou": ` + completeDigits + `, "keitai": ` + completeDigits + `}`,
+	} {
+		tablePath := filepath.Join(t.TempDir(), "ccode.json")
+		assert.Nil(t, ioutil.WriteFile(tablePath, []byte(table), 0644))
+
+		decoder, err := NewSubjectDecoder(tablePath, false)
+		assert.NotNil(t, err, name)
+		assert.Nil(t, decoder, name)
+	}
+}
@@ -1,10 +1,17 @@
 package details
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"strconv"
 	"time"
 )
 
+// defaultBatchSize is the number of ISBNs sent to OpenBD in one request.
+const defaultBatchSize = 100
+
 type DetailedInformation struct {
 	Author          string
 	Publisher       string
@@ -14,32 +21,212 @@ type DetailedInformation struct {
 	Format          string
 	Target          string
 	Content         string
+	Ndc             string
+	NdcClass        string
+	NdcDivision     string
+	GenreCode       string
+	Price           int
+	Pages           int
+	Size            string
+	TableOfContents string
+	Description     string
+	Contributors    []ContributorDetail
+	Series          string
+	Volume          string
+	CoverURL        string
+	PubDate         time.Time
+}
+
+// ContributorDetail is a person credited in the ONIX record.
+// Roles holds the ONIX contributor role codes, e.g. "A01" for the author.
+type ContributorDetail struct {
+	Name    string
+	Reading string
+	Roles   []string
 }
 
 type openBDClientInterface interface {
 	get(string) (*OpenBDResponse, error)
+	getBatch([]string) ([]*OpenBDResponse, error)
 }
 
 type OpenBDDetailsFetcher struct {
-	client  openBDClientInterface
-	decoder *SubjectDecoder
+	client     openBDClientInterface
+	decoder    *SubjectDecoder
+	ndcDecoder *NDCDecoder
+	batchSize  int
+}
+
+type fetcherSettings struct {
+	baseURL           string
+	httpClient        *http.Client
+	timeout           time.Duration
+	userAgent         string
+	batchSize         int
+	requestsPerSecond float64
+	retryPolicy       RetryPolicy
+	ndcDecoder        *NDCDecoder
+}
+
+// FetcherOption customizes an OpenBDDetailsFetcher created by NewOpenBDDetailsFetcher.
+type FetcherOption func(*fetcherSettings)
+
+// WithBaseURL points the fetcher at another OpenBD compatible endpoint, e.g. a local mirror or a stub server.
+func WithBaseURL(baseURL string) FetcherOption {
+	return func(s *fetcherSettings) {
+		s.baseURL = baseURL
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for OpenBD requests.
+// The client is not modified; when WithTimeout is also given, a copy of it is used.
+func WithHTTPClient(client *http.Client) FetcherOption {
+	return func(s *fetcherSettings) {
+		s.httpClient = client
+	}
+}
+
+// WithTimeout sets the time limit of each OpenBD request.
+func WithTimeout(timeout time.Duration) FetcherOption {
+	return func(s *fetcherSettings) {
+		s.timeout = timeout
+	}
+}
+
+// WithUserAgent sets the User-Agent header of OpenBD requests.
+func WithUserAgent(userAgent string) FetcherOption {
+	return func(s *fetcherSettings) {
+		s.userAgent = userAgent
+	}
+}
+
+// WithBatchSize sets the number of ISBNs sent to OpenBD in one batch request.
+func WithBatchSize(size int) FetcherOption {
+	return func(s *fetcherSettings) {
+		s.batchSize = size
+	}
+}
+
+// WithRequestsPerSecond limits the rate of requests sent to OpenBD.
+// Zero or a negative value disables the limit.
+func WithRequestsPerSecond(rps float64) FetcherOption {
+	return func(s *fetcherSettings) {
+		s.requestsPerSecond = rps
+	}
 }
 
-func NewOpenBDDetailsFetcher(decoder *SubjectDecoder) *OpenBDDetailsFetcher {
+// WithRetryPolicy sets how temporary failures of OpenBD requests are retried.
+func WithRetryPolicy(policy RetryPolicy) FetcherOption {
+	return func(s *fetcherSettings) {
+		s.retryPolicy = policy
+	}
+}
+
+// WithNDCDecoder makes the fetcher decode NDC into its class and division.
+// Without it, only the raw classification number is filled.
+func WithNDCDecoder(decoder *NDCDecoder) FetcherOption {
+	return func(s *fetcherSettings) {
+		s.ndcDecoder = decoder
+	}
+}
+
+func NewOpenBDDetailsFetcher(decoder *SubjectDecoder, opts ...FetcherOption) *OpenBDDetailsFetcher {
+	settings := fetcherSettings{
+		baseURL:     defaultOpenBDBaseURL,
+		userAgent:   DefaultUserAgent,
+		batchSize:   defaultBatchSize,
+		retryPolicy: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	var httpClient http.Client
+	if settings.httpClient != nil {
+		httpClient = *settings.httpClient
+	} else {
+		httpClient.Timeout = defaultTimeout
+	}
+	if settings.timeout > 0 {
+		httpClient.Timeout = settings.timeout
+	}
+
 	return &OpenBDDetailsFetcher{
-		client:  &openBDClient{},
-		decoder: decoder,
+		client: &openBDClient{
+			baseURL:     settings.baseURL,
+			httpClient:  &httpClient,
+			userAgent:   settings.userAgent,
+			limiter:     newRateLimiter(settings.requestsPerSecond),
+			retryPolicy: settings.retryPolicy,
+		},
+		decoder:    decoder,
+		ndcDecoder: settings.ndcDecoder,
+		batchSize:  settings.batchSize,
 	}
 }
 
 func (f *OpenBDDetailsFetcher) FetchDetailInfo(isbn string) (*DetailedInformation, error) {
 
 	res, err := f.client.get(isbn)
-	if err != nil {
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	} else if res == nil {
 		return nil, nil
 	}
+
+	return f.parseResponse(res), nil
+}
+
+// FetchDetailInfoBatch looks up the ISBNs in chunks, sending one OpenBD request per chunk.
+// The result has an entry for every ISBN of the chunks which were fetched successfully;
+// the entry is nil when OpenBD has no record of the ISBN.
+// ISBNs of failed chunks are missing from the result and reported in the returned error.
+func (f *OpenBDDetailsFetcher) FetchDetailInfoBatch(isbns []string) (map[string]*DetailedInformation, error) {
+
+	detailsByISBN := make(map[string]*DetailedInformation, len(isbns))
+	var failedISBNs []string
+	var lastErr error
+	for _, chunk := range splitIntoChunks(isbns, f.batchSize) {
+		responses, err := f.client.getBatch(chunk)
+		if err != nil {
+			failedISBNs = append(failedISBNs, chunk...)
+			lastErr = err
+			continue
+		}
+		for i, res := range responses {
+			if res == nil {
+				detailsByISBN[chunk[i]] = nil
+				continue
+			}
+			detailsByISBN[chunk[i]] = f.parseResponse(res)
+		}
+	}
+
+	if len(failedISBNs) > 0 {
+		return detailsByISBN, fmt.Errorf("failed in fetching %d of %d ISBN(s): %s", len(failedISBNs), len(isbns), lastErr)
+	}
+	return detailsByISBN, nil
+}
+
+func splitIntoChunks(isbns []string, size int) [][]string {
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	var chunks [][]string
+	for start := 0; start < len(isbns); start += size {
+		end := start + size
+		if end > len(isbns) {
+			end = len(isbns)
+		}
+		chunks = append(chunks, isbns[start:end])
+	}
+	return chunks
+}
+
+func (f *OpenBDDetailsFetcher) parseResponse(res *OpenBDResponse) *DetailedInformation {
+
 	summary := res.Summary
 	author := summary.Author
 	publisher := summary.Publisher
@@ -57,21 +244,31 @@ func (f *OpenBDDetailsFetcher) FetchDetailInfo(isbn string) (*DetailedInformatio
 		log.Printf("Error in parsing timestamp: %s", hanmoto.DateModified)
 	}
 
-	var ccode string
 	subjects := res.Onix.DescriptiveDetail.Subject
-	if len(subjects) > 0 {
-		ccode = subjects[0].SubjectCode
-	}
+	ccode := findSubjectCode(subjects, subjectSchemeCcode)
 	var format, target, content string
 	decoded, err := f.decoder.Decode(ccode)
 	if err != nil {
 		log.Println("Failed in decoding Ccode: ", err)
-	} else {
+	}
+	if decoded != nil {
 		format = decoded.Format
 		target = decoded.Target
 		content = decoded.Content
 	}
 
+	ndc := findSubjectCode(subjects, subjectSchemeNDC)
+	var ndcClass, ndcDivision string
+	if ndc != "" && f.ndcDecoder != nil {
+		decodedNDC, err := f.ndcDecoder.Decode(ndc)
+		if err != nil {
+			log.Println("Failed in decoding NDC: ", err)
+		} else {
+			ndcClass = decodedNDC.Class
+			ndcDivision = decodedNDC.Division
+		}
+	}
+
 	return &DetailedInformation{
 		Author:          author,
 		Publisher:       publisher,
@@ -81,6 +278,165 @@ func (f *OpenBDDetailsFetcher) FetchDetailInfo(isbn string) (*DetailedInformatio
 		Format:          format,
 		Target:          target,
 		Content:         content,
-	}, nil
+		Ndc:             ndc,
+		NdcClass:        ndcClass,
+		NdcDivision:     ndcDivision,
+		GenreCode:       findSubjectCode(subjects, subjectSchemeGenre),
+		Price:           extractPrice(&res.Onix),
+		Pages:           extractPages(&res.Onix),
+		Size:            extractSize(&res.Onix),
+		TableOfContents: extractText(&res.Onix, textTypeTableOfContents),
+		Description:     extractText(&res.Onix, textTypeDescription, textTypeShortDescription),
+		Contributors:    extractContributors(&res.Onix),
+		Series:          summary.Series,
+		Volume:          summary.Volume,
+		CoverURL:        extractCoverURL(res),
+		PubDate:         extractPubDate(res, loc),
+	}
+}
+
+// ONIX code values used in the OpenBD records.
+const (
+	subjectSchemeCcode = "78"
+	subjectSchemeNDC   = "79"
+	subjectSchemeGenre = "191"
+
+	textTypeShortDescription = "02"
+	textTypeDescription      = "03"
+	textTypeTableOfContents  = "04"
+
+	extentTypeMainContentPages = "11"
+
+	measureTypeHeight = "01"
+	measureTypeWidth  = "02"
+
+	resourceContentTypeFrontCover = "01"
 
+	publishingDateRolePublication = "01"
+)
+
+// findSubjectCode returns the code of the first subject of the scheme,
+// since the position of each scheme in the Subject list differs between records.
+func findSubjectCode(subjects []Subject, schemeIdentifier string) string {
+	for _, subject := range subjects {
+		if subject.SubjectSchemeIdentifier == schemeIdentifier {
+			return subject.SubjectCode
+		}
+	}
+	return ""
+}
+
+func extractPrice(onix *Onix) int {
+	for _, price := range onix.ProductSupply.SupplyDetail.Price {
+		if price.CurrencyCode != "" && price.CurrencyCode != "JPY" {
+			continue
+		}
+		amount, err := strconv.Atoi(price.PriceAmount)
+		if err != nil {
+			log.Printf("Error in parsing price: %s", price.PriceAmount)
+			continue
+		}
+		return amount
+	}
+	return 0
+}
+
+func extractPages(onix *Onix) int {
+	for _, extent := range onix.DescriptiveDetail.Extent {
+		if extent.ExtentType != extentTypeMainContentPages {
+			continue
+		}
+		pages, err := strconv.Atoi(extent.ExtentValue)
+		if err != nil {
+			log.Printf("Error in parsing page count: %s", extent.ExtentValue)
+			continue
+		}
+		return pages
+	}
+	return 0
+}
+
+// extractSize formats the height and width of the book, e.g. "188x128mm".
+func extractSize(onix *Onix) string {
+	var height, width, unit string
+	for _, measure := range onix.DescriptiveDetail.Measure {
+		switch measure.MeasureType {
+		case measureTypeHeight:
+			height = measure.Measurement
+			unit = measure.MeasureUnitCode
+		case measureTypeWidth:
+			width = measure.Measurement
+		}
+	}
+	if height == "" || width == "" {
+		return ""
+	}
+	return fmt.Sprintf("%sx%s%s", height, width, unit)
+}
+
+// extractText returns the first text content of the given types, in the order of preference.
+func extractText(onix *Onix, textTypes ...string) string {
+	for _, textType := range textTypes {
+		for _, textContent := range onix.CollateralDetail.TextContent {
+			if textContent.TextType == textType && textContent.Text != "" {
+				return textContent.Text
+			}
+		}
+	}
+	return ""
+}
+
+func extractContributors(onix *Onix) []ContributorDetail {
+	var contributors []ContributorDetail
+	for _, contributor := range onix.DescriptiveDetail.Contributor {
+		contributors = append(contributors, ContributorDetail{
+			Name:    contributor.PersonName.Content,
+			Reading: contributor.PersonName.CollationKey,
+			Roles:   contributor.ContributorRole,
+		})
+	}
+	return contributors
+}
+
+func extractCoverURL(res *OpenBDResponse) string {
+	if res.Summary.Cover != "" {
+		return res.Summary.Cover
+	}
+	for _, resource := range res.Onix.CollateralDetail.SupportingResource {
+		if resource.ResourceContentType != resourceContentTypeFrontCover {
+			continue
+		}
+		for _, version := range resource.ResourceVersion {
+			if version.ResourceLink != "" {
+				return version.ResourceLink
+			}
+		}
+	}
+	return ""
+}
+
+// extractPubDate parses the publication date of the ONIX record, falling back to the summary.
+// Dates of OpenBD may omit the day or the month, e.g. "202408".
+func extractPubDate(res *OpenBDResponse, loc *time.Location) time.Time {
+	date := res.Summary.PubDate
+	for _, publishingDate := range res.Onix.PublishingDetail.PublishingDate {
+		if publishingDate.PublishingDateRole == publishingDateRolePublication && publishingDate.Date != "" {
+			date = publishingDate.Date
+			break
+		}
+	}
+	if date == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{"20060102", "200601", "2006"} {
+		if len(date) != len(layout) {
+			continue
+		}
+		if pubDate, err := time.ParseInLocation(layout, date, loc); err == nil {
+			return pubDate
+		}
+	}
+	log.Printf("Error in parsing publication date: %s", date)
+	return time.Time{}
 }
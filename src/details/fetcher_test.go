@@ -2,6 +2,8 @@ package details
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -30,9 +32,56 @@ var sampleOpenBDResp = OpenBDResponse{
 			Subject: []Subject{
 				{
 					MainSubject:             "",
-					SubjectSchemeIdentifier: "00",
+					SubjectSchemeIdentifier: "79",
+					SubjectCode:             "913.6",
+				},
+				{
+					MainSubject:             "",
+					SubjectSchemeIdentifier: "78",
 					SubjectCode:             "1040",
 				},
+				{
+					SubjectSchemeIdentifier: "191",
+					SubjectCode:             "01",
+				},
+			},
+			Measure: []Measure{
+				{MeasureType: "01", Measurement: "188", MeasureUnitCode: "mm"},
+				{MeasureType: "02", Measurement: "128", MeasureUnitCode: "mm"},
+			},
+			Contributor: []Contributor{
+				{
+					SequenceNumber:  "1",
+					ContributorRole: []string{"A01"},
+					PersonName:      PersonName{Content: "tatamiya tamiya", CollationKey: "タタミヤ タミヤ"},
+				},
+				{
+					SequenceNumber:  "2",
+					ContributorRole: []string{"B01"},
+					PersonName:      PersonName{Content: "畳の科学", CollationKey: "タタミノカガク"},
+				},
+			},
+			Extent: []Extent{
+				{ExtentType: "11", ExtentValue: "256", ExtentUnit: "03"},
+			},
+		},
+		CollateralDetail: CollateralDetail{
+			TextContent: []TextContent{
+				{TextType: "02", Text: "畳の本"},
+				{TextType: "03", Text: "畳にまつわる物理学の本"},
+				{TextType: "04", Text: "第1章 い草\n第2章 畳縁"},
+			},
+		},
+		PublishingDetail: PublishingDetail{
+			PublishingDate: []PublishingDate{
+				{PublishingDateRole: "01", Date: "20240830"},
+			},
+		},
+		ProductSupply: ProductSupply{
+			SupplyDetail: SupplyDetail{
+				Price: []Price{
+					{PriceType: "03", CurrencyCode: "JPY", PriceAmount: "2400"},
+				},
 			},
 		},
 	},
@@ -49,12 +98,14 @@ var sampleOpenBDResp = OpenBDResponse{
 		Publisher: "畳屋書店",
 		PubDate:   "20240831",
 		Author:    "tatamiya tamiya／著 畳の科学／編集",
+		Cover:     "https://cover.openbd.jp/1111111111111.jpg",
 	},
 }
 
 type openBDClientStub struct {
-	Responses map[string]*OpenBDResponse
-	IsError   bool
+	Responses    map[string]*OpenBDResponse
+	IsError      bool
+	BatchQueries [][]string
 }
 
 func (c *openBDClientStub) get(isbn string) (*OpenBDResponse, error) {
@@ -71,6 +122,20 @@ func (c *openBDClientStub) get(isbn string) (*OpenBDResponse, error) {
 	return res, nil
 }
 
+func (c *openBDClientStub) getBatch(isbns []string) ([]*OpenBDResponse, error) {
+	c.BatchQueries = append(c.BatchQueries, isbns)
+	if c.IsError {
+		return nil, fmt.Errorf("OpenBD request failed!")
+	}
+
+	var responses []*OpenBDResponse
+	for _, isbn := range isbns {
+		responses = append(responses, c.Responses[isbn])
+	}
+
+	return responses, nil
+}
+
 func TestFetcherParsesOpenBDResopnseCorrectly(t *testing.T) {
 
 	testFetcher := OpenBDDetailsFetcher{
@@ -80,7 +145,8 @@ func TestFetcherParsesOpenBDResopnseCorrectly(t *testing.T) {
 			},
 			IsError: false,
 		},
-		decoder: &sampleDecoder,
+		decoder:    &sampleDecoder,
+		ndcDecoder: &testNDCDecoder,
 	}
 
 	actualDetailedInfo, err := testFetcher.FetchDetailInfo("1111111111111")
@@ -97,6 +163,23 @@ func TestFetcherParsesOpenBDResopnseCorrectly(t *testing.T) {
 		Format:          "単行本",
 		Target:          "教養",
 		Content:         "自然科学総記",
+		Ndc:             "913.6",
+		NdcClass:        "文学",
+		NdcDivision:     "日本文学",
+		GenreCode:       "01",
+		Price:           2400,
+		Pages:           256,
+		Size:            "188x128mm",
+		TableOfContents: "第1章 い草\n第2章 畳縁",
+		Description:     "畳にまつわる物理学の本",
+		Contributors: []ContributorDetail{
+			{Name: "tatamiya tamiya", Reading: "タタミヤ タミヤ", Roles: []string{"A01"}},
+			{Name: "畳の科学", Reading: "タタミノカガク", Roles: []string{"B01"}},
+		},
+		Series:   "シリーズ畳の不思議",
+		Volume:   "1",
+		CoverURL: "https://cover.openbd.jp/1111111111111.jpg",
+		PubDate:  time.Date(2024, time.August, 30, 0, 0, 0, 0, loc),
 	}
 
 	assert.Nil(t, err)
@@ -108,7 +191,7 @@ func TestFetcherFillsByEmptyWhenInvalidCcodeIsInput(t *testing.T) {
 	sampleOpenBDResp.Onix = Onix{
 		DescriptiveDetail: DescriptiveDetail{
 			Subject: []Subject{
-				{SubjectCode: "XXXX"},
+				{SubjectSchemeIdentifier: "78", SubjectCode: "XXXX"},
 			},
 		},
 	}
@@ -187,3 +270,187 @@ func TestFetcherReturnsErrorWhenOpenBDRequestFails(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Nil(t, actualDetailedInfo)
 }
+
+func TestFetcherSplitsISBNsIntoBatches(t *testing.T) {
+
+	testClient := openBDClientStub{
+		Responses: map[string]*OpenBDResponse{
+			"1111111111111": {Summary: Summary{Author: "author1"}},
+			"3333333333333": {Summary: Summary{Author: "author3"}},
+		},
+		IsError: false,
+	}
+	testFetcher := OpenBDDetailsFetcher{
+		client:    &testClient,
+		decoder:   &sampleDecoder,
+		batchSize: 2,
+	}
+
+	actualDetails, err := testFetcher.FetchDetailInfoBatch([]string{"1111111111111", "2222222222222", "3333333333333"})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, [][]string{{"1111111111111", "2222222222222"}, {"3333333333333"}}, testClient.BatchQueries)
+	assert.Equal(t, 3, len(actualDetails))
+	assert.Equal(t, "author1", actualDetails["1111111111111"].Author)
+	assert.Nil(t, actualDetails["2222222222222"])
+	assert.Equal(t, "author3", actualDetails["3333333333333"].Author)
+}
+
+func TestFetcherOmitsISBNsOfFailedBatches(t *testing.T) {
+
+	testFetcher := OpenBDDetailsFetcher{
+		client: &openBDClientStub{
+			IsError: true,
+		},
+		decoder:   &sampleDecoder,
+		batchSize: 2,
+	}
+
+	actualDetails, err := testFetcher.FetchDetailInfoBatch([]string{"1111111111111", "2222222222222", "3333333333333"})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(actualDetails))
+}
+
+func TestNewFetcherAppliesOptions(t *testing.T) {
+
+	defaultFetcher := NewOpenBDDetailsFetcher(&sampleDecoder)
+	assert.Equal(t, defaultBatchSize, defaultFetcher.batchSize)
+
+	customFetcher := NewOpenBDDetailsFetcher(&sampleDecoder, WithBatchSize(10), WithRequestsPerSecond(2))
+	assert.Equal(t, 10, customFetcher.batchSize)
+	assert.EqualValues(t, 2, customFetcher.client.(*openBDClient).limiter.Limit())
+}
+
+func TestFetcherSendsRequestsToConfiguredServer(t *testing.T) {
+	var actualUserAgent, actualQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actualUserAgent = r.Header.Get("User-Agent")
+		actualQuery = r.URL.Query().Get("isbn")
+		fmt.Fprint(w, `[{"summary": {"isbn": "1111111111111", "author": "tatamiya tamiya／著"}}]`)
+	}))
+	defer server.Close()
+
+	testFetcher := NewOpenBDDetailsFetcher(
+		&sampleDecoder,
+		WithBaseURL(server.URL),
+		WithHTTPClient(server.Client()),
+		WithUserAgent("test-agent"),
+	)
+
+	actualDetailedInfo, err := testFetcher.FetchDetailInfo("1111111111111")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "tatamiya tamiya／著", actualDetailedInfo.Author)
+	assert.Equal(t, "test-agent", actualUserAgent)
+	assert.Equal(t, "1111111111111", actualQuery)
+}
+
+func TestFetcherTimeoutDoesNotModifyGivenHTTPClient(t *testing.T) {
+	givenClient := &http.Client{Timeout: time.Minute}
+
+	testFetcher := NewOpenBDDetailsFetcher(&sampleDecoder, WithHTTPClient(givenClient), WithTimeout(time.Second))
+
+	assert.Equal(t, time.Minute, givenClient.Timeout)
+	assert.Equal(t, time.Second, testFetcher.client.(*openBDClient).httpClient.Timeout)
+}
+
+func TestExtractPubDateFallsBackToSummaryAndPartialDates(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+
+	resWithSummaryDate := OpenBDResponse{Summary: Summary{PubDate: "20240831"}}
+	assert.Equal(t, time.Date(2024, time.August, 31, 0, 0, 0, 0, loc), extractPubDate(&resWithSummaryDate, loc))
+
+	resWithMonth := OpenBDResponse{Summary: Summary{PubDate: "202408"}}
+	assert.Equal(t, time.Date(2024, time.August, 1, 0, 0, 0, 0, loc), extractPubDate(&resWithMonth, loc))
+
+	resWithoutDate := OpenBDResponse{}
+	assert.True(t, extractPubDate(&resWithoutDate, loc).IsZero())
+}
+
+func TestExtractDescriptionFallsBackToShortDescription(t *testing.T) {
+	onix := Onix{
+		CollateralDetail: CollateralDetail{
+			TextContent: []TextContent{
+				{TextType: "02", Text: "畳の本"},
+			},
+		},
+	}
+
+	assert.Equal(t, "畳の本", extractText(&onix, textTypeDescription, textTypeShortDescription))
+	assert.Equal(t, "", extractText(&onix, textTypeTableOfContents))
+}
+
+func TestExtractCoverURLFromSupportingResource(t *testing.T) {
+	res := OpenBDResponse{
+		Onix: Onix{
+			CollateralDetail: CollateralDetail{
+				SupportingResource: []SupportingResource{
+					{
+						ResourceContentType: "01",
+						ResourceVersion: []ResourceVersion{
+							{ResourceForm: "02", ResourceLink: "https://example.com/cover.jpg"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, "https://example.com/cover.jpg", extractCoverURL(&res))
+}
+
+func TestFetcherPicksSubjectsBySchemeIdentifier(t *testing.T) {
+	res := OpenBDResponse{
+		Onix: Onix{
+			DescriptiveDetail: DescriptiveDetail{
+				Subject: []Subject{
+					{SubjectSchemeIdentifier: "191", SubjectCode: "01"},
+					{SubjectSchemeIdentifier: "79", SubjectCode: "410"},
+				},
+			},
+		},
+	}
+	testFetcher := OpenBDDetailsFetcher{
+		client: &openBDClientStub{
+			Responses: map[string]*OpenBDResponse{"1111111111111": &res},
+		},
+		decoder: &sampleDecoder,
+	}
+
+	actualDetailedInfo, err := testFetcher.FetchDetailInfo("1111111111111")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "", actualDetailedInfo.Ccode)
+	assert.Equal(t, "", actualDetailedInfo.Content)
+	assert.Equal(t, "410", actualDetailedInfo.Ndc)
+	assert.Equal(t, "", actualDetailedInfo.NdcClass)
+	assert.Equal(t, "01", actualDetailedInfo.GenreCode)
+}
+
+func TestFetcherKeepsPartiallyDecodedSubjectInStrictMode(t *testing.T) {
+	strictDecoder := sampleDecoder
+	strictDecoder.strict = true
+	res := OpenBDResponse{
+		Onix: Onix{
+			DescriptiveDetail: DescriptiveDetail{
+				Subject: []Subject{
+					{SubjectSchemeIdentifier: "78", SubjectCode: "1049"},
+				},
+			},
+		},
+	}
+	testFetcher := OpenBDDetailsFetcher{
+		client: &openBDClientStub{
+			Responses: map[string]*OpenBDResponse{"1111111111111": &res},
+		},
+		decoder: &strictDecoder,
+	}
+
+	actualDetailedInfo, err := testFetcher.FetchDetailInfo("1111111111111")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "教養", actualDetailedInfo.Target)
+	assert.Equal(t, "単行本", actualDetailedInfo.Format)
+	assert.Equal(t, "", actualDetailedInfo.Content)
+}
@@ -0,0 +1,63 @@
+package details
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+)
+
+//go:embed ndc.json
+var defaultNDCTable []byte
+
+// NDCDecoder decodes the Nippon Decimal Classification into its class (類) and division (綱).
+type NDCDecoder struct {
+	Rui map[string]string `json:"rui"`
+	Kou map[string]string `json:"kou"`
+}
+
+type DecodedNDC struct {
+	Ndc      string
+	Class    string
+	Division string
+}
+
+// Decode accepts a classification number with at least three digits, e.g. "410" or "913.6".
+func (d *NDCDecoder) Decode(ndc string) (*DecodedNDC, error) {
+
+	if len(ndc) < 3 {
+		return nil, fmt.Errorf("invalid NDC! %s is shorter than 3 digits", ndc)
+	}
+	if _, err := strconv.Atoi(ndc[:3]); err != nil {
+		return nil, fmt.Errorf("invalid NDC! %s does not start with 3 digits: %s", ndc, err)
+	}
+	class := d.Rui[ndc[:1]]
+	division := d.Kou[ndc[:2]]
+
+	return &DecodedNDC{
+		ndc, class, division,
+	}, nil
+}
+
+// NewNDCDecoder loads the NDC table from codeTablePath,
+// or the table embedded in the binary if codeTablePath is empty.
+func NewNDCDecoder(codeTablePath string) (*NDCDecoder, error) {
+
+	ndcData := defaultNDCTable
+	if codeTablePath != "" {
+		var ioErr error
+		ndcData, ioErr = ioutil.ReadFile(codeTablePath)
+		if ioErr != nil {
+			return nil, fmt.Errorf("could not read ndc.json!: %s", ioErr)
+		}
+	}
+
+	var decoder NDCDecoder
+	jsonErr := json.Unmarshal(ndcData, &decoder)
+	if jsonErr != nil {
+		return nil, fmt.Errorf("could not unmarshal json data!: %s", jsonErr)
+	}
+
+	return &decoder, nil
+}
@@ -0,0 +1,57 @@
+package details
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNDCDecoder = NDCDecoder{
+	Rui: map[string]string{
+		"4": "自然科学",
+		"9": "文学",
+	},
+	Kou: map[string]string{
+		"41": "数学",
+		"91": "日本文学",
+	},
+}
+
+func TestDecodeNDCCorrectly(t *testing.T) {
+
+	expectedDecoded := DecodedNDC{
+		Ndc:      "913.6",
+		Class:    "文学",
+		Division: "日本文学",
+	}
+
+	actualDecoded, err := testNDCDecoder.Decode("913.6")
+	assert.Nil(t, err)
+	assert.EqualValues(t, expectedDecoded, *actualDecoded)
+}
+
+func TestDecodingNDCFailsWhenItIsNotDigits(t *testing.T) {
+
+	actualDecoded, err := testNDCDecoder.Decode("4a0")
+	assert.NotNil(t, err)
+	assert.Nil(t, actualDecoded)
+
+	actualDecoded, err = testNDCDecoder.Decode("41")
+	assert.NotNil(t, err)
+	assert.Nil(t, actualDecoded)
+}
+
+func TestNewNDCDecoder(t *testing.T) {
+	decoder, err := NewNDCDecoder("./ndc.json")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "自然科学", decoder.Rui["4"])
+	assert.EqualValues(t, "物理学", decoder.Kou["42"])
+	assert.Equal(t, 10, len(decoder.Rui))
+	assert.Equal(t, 100, len(decoder.Kou))
+}
+
+func TestNewNDCDecoderLoadsEmbeddedTableByDefault(t *testing.T) {
+	decoder, err := NewNDCDecoder("")
+	assert.Nil(t, err)
+	assert.EqualValues(t, "文学", decoder.Rui["9"])
+}
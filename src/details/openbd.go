@@ -1,9 +1,16 @@
 package details
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
 )
 
 type OpenBDResponse struct {
@@ -14,10 +21,39 @@ type OpenBDResponse struct {
 
 type Onix struct {
 	DescriptiveDetail DescriptiveDetail `json:"DescriptiveDetail"`
+	CollateralDetail  CollateralDetail  `json:"CollateralDetail"`
+	PublishingDetail  PublishingDetail  `json:"PublishingDetail"`
+	ProductSupply     ProductSupply     `json:"ProductSupply"`
 }
 
 type DescriptiveDetail struct {
-	Subject []Subject `json:"Subject"`
+	Measure     []Measure     `json:"Measure"`
+	Contributor []Contributor `json:"Contributor"`
+	Extent      []Extent      `json:"Extent"`
+	Subject     []Subject     `json:"Subject"`
+}
+
+type Measure struct {
+	MeasureType     string `json:"MeasureType"`
+	Measurement     string `json:"Measurement"`
+	MeasureUnitCode string `json:"MeasureUnitCode"`
+}
+
+type Contributor struct {
+	SequenceNumber  string     `json:"SequenceNumber"`
+	ContributorRole []string   `json:"ContributorRole"`
+	PersonName      PersonName `json:"PersonName"`
+}
+
+type PersonName struct {
+	Content      string `json:"content"`
+	CollationKey string `json:"collationkey"`
+}
+
+type Extent struct {
+	ExtentType  string `json:"ExtentType"`
+	ExtentValue string `json:"ExtentValue"`
+	ExtentUnit  string `json:"ExtentUnit"`
 }
 
 type Subject struct {
@@ -26,6 +62,50 @@ type Subject struct {
 	SubjectCode             string `json:"SubjectCode"`
 }
 
+type CollateralDetail struct {
+	TextContent        []TextContent        `json:"TextContent"`
+	SupportingResource []SupportingResource `json:"SupportingResource"`
+}
+
+type TextContent struct {
+	TextType        string `json:"TextType"`
+	ContentAudience string `json:"ContentAudience"`
+	Text            string `json:"Text"`
+}
+
+type SupportingResource struct {
+	ResourceContentType string            `json:"ResourceContentType"`
+	ResourceVersion     []ResourceVersion `json:"ResourceVersion"`
+}
+
+type ResourceVersion struct {
+	ResourceForm string `json:"ResourceForm"`
+	ResourceLink string `json:"ResourceLink"`
+}
+
+type PublishingDetail struct {
+	PublishingDate []PublishingDate `json:"PublishingDate"`
+}
+
+type PublishingDate struct {
+	PublishingDateRole string `json:"PublishingDateRole"`
+	Date               string `json:"Date"`
+}
+
+type ProductSupply struct {
+	SupplyDetail SupplyDetail `json:"SupplyDetail"`
+}
+
+type SupplyDetail struct {
+	Price []Price `json:"Price"`
+}
+
+type Price struct {
+	PriceType    string `json:"PriceType"`
+	CurrencyCode string `json:"CurrencyCode"`
+	PriceAmount  string `json:"PriceAmount"`
+}
+
 type Hanmoto struct {
 	DateModified string `json:"datemodified"`
 	DateCreated  string `json:"datecreated"`
@@ -40,26 +120,150 @@ type Summary struct {
 	Publisher string `json:"publisher"`
 	PubDate   string `json:"pubdate"`
 	Author    string `json:"author"`
+	Cover     string `json:"cover"`
+}
+
+const (
+	defaultOpenBDBaseURL = "https://api.openbd.jp/v1/get"
+	defaultTimeout       = 30 * time.Second
+)
+
+// DefaultUserAgent identifies the requests to OpenBD unless WithUserAgent is given.
+const DefaultUserAgent = "new-books-notification (+https://github.com/tatamiya/new-books-notification)"
+
+// Kinds of errors returned by the OpenBD client.
+// Use errors.Is to classify an error, e.g. errors.Is(err, details.ErrServerStatus).
+var (
+	ErrTransient         = errors.New("transient network error")
+	ErrClientStatus      = errors.New("OpenBD returned a client error status")
+	ErrServerStatus      = errors.New("OpenBD returned a server error status")
+	ErrMalformedResponse = errors.New("malformed OpenBD response")
+	ErrNotFound          = errors.New("ISBN not found in OpenBD")
+)
+
+type OpenBDError struct {
+	Kind       error
+	StatusCode int
+	Err        error
+}
+
+func (e *OpenBDError) Error() string {
+	message := e.Kind.Error()
+	if e.StatusCode != 0 {
+		message = fmt.Sprintf("%s (HTTP %d)", message, e.StatusCode)
+	}
+	if e.Err != nil {
+		message = fmt.Sprintf("%s: %s", message, e.Err)
+	}
+	return message
+}
+
+func (e *OpenBDError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OpenBDError) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Temporary reports whether the same request may succeed when it is sent again.
+func (e *OpenBDError) Temporary() bool {
+	return e.Kind == ErrTransient || e.Kind == ErrServerStatus || e.StatusCode == http.StatusTooManyRequests
 }
 
 type openBDClient struct {
+	baseURL     string
+	httpClient  *http.Client
+	userAgent   string
+	limiter     *rate.Limiter
+	retryPolicy RetryPolicy
+}
+
+func newRateLimiter(requestsPerSecond float64) *rate.Limiter {
+	if requestsPerSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(requestsPerSecond), 1)
 }
 
 func (c *openBDClient) get(isbn string) (*OpenBDResponse, error) {
-	openbdUrl := fmt.Sprintf("https://api.openbd.jp/v1/get?isbn=%s&pretty", isbn)
-	resp, respErr := http.Get(openbdUrl)
-	if respErr != nil {
-		err := fmt.Errorf("OpenBD request failed: %s", respErr)
+	openBDResp, err := c.getBatch([]string{isbn})
+	if err != nil {
 		return nil, err
 	}
+	if openBDResp[0] == nil {
+		return nil, &OpenBDError{Kind: ErrNotFound, Err: fmt.Errorf("no record for %s", isbn)}
+	}
+
+	return openBDResp[0], nil
+}
+
+// getBatch looks up several ISBNs in a single request, retrying it on temporary failures.
+// OpenBD returns the records in the same order as the query and null for unknown ISBNs,
+// so the i-th element of the result corresponds to isbns[i] and may be nil.
+func (c *openBDClient) getBatch(isbns []string) ([]*OpenBDResponse, error) {
+	for attempt := 1; ; attempt++ {
+		openBDResp, err := c.request(isbns)
+		if err == nil {
+			return openBDResp, nil
+		}
+
+		var openBDErr *OpenBDError
+		if !errors.As(err, &openBDErr) || !openBDErr.Temporary() || attempt >= c.retryPolicy.MaxAttempts {
+			return nil, err
+		}
+		wait := c.retryPolicy.backoff(attempt)
+		log.Printf("OpenBD request failed (attempt %d/%d), retrying in %s: %s", attempt, c.retryPolicy.MaxAttempts, wait, err)
+		time.Sleep(wait)
+	}
+}
+
+func (c *openBDClient) request(isbns []string) ([]*OpenBDResponse, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(context.Background()); err != nil {
+			return nil, fmt.Errorf("OpenBD request was not sent: %s", err)
+		}
+	}
+
+	baseURL := c.baseURL
+	if baseURL == "" {
+		baseURL = defaultOpenBDBaseURL
+	}
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+
+	openbdUrl := fmt.Sprintf("%s?isbn=%s", baseURL, strings.Join(isbns, ","))
+	req, err := http.NewRequest(http.MethodGet, openbdUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create OpenBD request: %s", err)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, respErr := httpClient.Do(req)
+	if respErr != nil {
+		return nil, &OpenBDError{Kind: ErrTransient, Err: respErr}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return nil, &OpenBDError{Kind: ErrServerStatus, StatusCode: resp.StatusCode}
+	} else if resp.StatusCode >= 400 {
+		return nil, &OpenBDError{Kind: ErrClientStatus, StatusCode: resp.StatusCode}
+	}
 
 	var openBDResp []*OpenBDResponse
 	decodeErr := json.NewDecoder(resp.Body).Decode(&openBDResp)
 	if decodeErr != nil {
-		err := fmt.Errorf("error in decoding OpenBD JSON response: %s", decodeErr)
-
-		return nil, err
+		return nil, &OpenBDError{Kind: ErrMalformedResponse, Err: decodeErr}
+	}
+	if len(openBDResp) != len(isbns) {
+		err := fmt.Errorf("%d record(s) returned for %d ISBN(s)", len(openBDResp), len(isbns))
+		return nil, &OpenBDError{Kind: ErrMalformedResponse, Err: err}
 	}
 
-	return openBDResp[0], nil
+	return openBDResp, nil
 }
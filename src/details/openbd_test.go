@@ -0,0 +1,141 @@
+package details
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     2 * time.Millisecond,
+}
+
+func newTestOpenBDServer(statusCodes []int, body string) (*httptest.Server, *int) {
+	numRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statusCode := http.StatusOK
+		if numRequests < len(statusCodes) {
+			statusCode = statusCodes[numRequests]
+		}
+		numRequests++
+		w.WriteHeader(statusCode)
+		fmt.Fprint(w, body)
+	}))
+	return server, &numRequests
+}
+
+func TestClientRetriesOnServerError(t *testing.T) {
+	server, numRequests := newTestOpenBDServer(
+		[]int{http.StatusServiceUnavailable, http.StatusBadGateway},
+		`[{"summary": {"isbn": "1111111111111"}}]`,
+	)
+	defer server.Close()
+
+	client := openBDClient{baseURL: server.URL, retryPolicy: testRetryPolicy}
+	res, err := client.get("1111111111111")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1111111111111", res.Summary.ISBN)
+	assert.Equal(t, 3, *numRequests)
+}
+
+func TestClientGivesUpAfterMaxAttempts(t *testing.T) {
+	server, numRequests := newTestOpenBDServer(
+		[]int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+		`[]`,
+	)
+	defer server.Close()
+
+	client := openBDClient{baseURL: server.URL, retryPolicy: testRetryPolicy}
+	res, err := client.get("1111111111111")
+
+	assert.Nil(t, res)
+	assert.True(t, errors.Is(err, ErrServerStatus))
+	assert.Equal(t, 3, *numRequests)
+}
+
+func TestClientDoesNotRetryOnClientError(t *testing.T) {
+	server, numRequests := newTestOpenBDServer([]int{http.StatusBadRequest}, `[]`)
+	defer server.Close()
+
+	client := openBDClient{baseURL: server.URL, retryPolicy: testRetryPolicy}
+	res, err := client.get("1111111111111")
+
+	assert.Nil(t, res)
+	assert.True(t, errors.Is(err, ErrClientStatus))
+	assert.Equal(t, 1, *numRequests)
+}
+
+func TestClientRetriesWhenRateLimited(t *testing.T) {
+	server, numRequests := newTestOpenBDServer(
+		[]int{http.StatusTooManyRequests},
+		`[{"summary": {"isbn": "1111111111111"}}]`,
+	)
+	defer server.Close()
+
+	client := openBDClient{baseURL: server.URL, retryPolicy: testRetryPolicy}
+	_, err := client.get("1111111111111")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *numRequests)
+}
+
+func TestClientReportsMalformedResponse(t *testing.T) {
+	server, numRequests := newTestOpenBDServer(nil, `{"not": "an array"`)
+	defer server.Close()
+
+	client := openBDClient{baseURL: server.URL, retryPolicy: testRetryPolicy}
+	res, err := client.get("1111111111111")
+
+	assert.Nil(t, res)
+	assert.True(t, errors.Is(err, ErrMalformedResponse))
+	assert.Equal(t, 1, *numRequests)
+}
+
+func TestClientReportsNotFound(t *testing.T) {
+	server, _ := newTestOpenBDServer(nil, `[null]`)
+	defer server.Close()
+
+	client := openBDClient{baseURL: server.URL, retryPolicy: testRetryPolicy}
+	res, err := client.get("1111111111111")
+
+	assert.Nil(t, res)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestClientReportsTransientErrorWhenServerIsDown(t *testing.T) {
+	server, _ := newTestOpenBDServer(nil, `[]`)
+	server.Close()
+
+	client := openBDClient{baseURL: server.URL, retryPolicy: testRetryPolicy}
+	res, err := client.get("1111111111111")
+
+	assert.Nil(t, res)
+	assert.True(t, errors.Is(err, ErrTransient))
+}
+
+func TestBackoffGrowsExponentiallyUpToMax(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+	}
+
+	for attempt, maxWait := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 300 * time.Millisecond,
+		4: 300 * time.Millisecond,
+	} {
+		wait := policy.backoff(attempt)
+		assert.GreaterOrEqual(t, int64(wait), int64(maxWait/2))
+		assert.Less(t, int64(wait), int64(maxWait))
+	}
+}
@@ -0,0 +1,213 @@
+package dryrun
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tatamiya/new-books-notification/src/models"
+	"github.com/tatamiya/new-books-notification/src/uploader"
+)
+
+// Notifier, Recorder, Tracker and Uploader only log and keep what would be done in a dry run.
+type Notifier struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (n *Notifier) Post(message string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	log.Printf("[dry run] Would notify:\n%s", message)
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func (n *Notifier) Messages() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string{}, n.messages...)
+}
+
+// RecordedLookup looks up the books recorded by the configured recorder, opened read-only.
+type RecordedLookup interface {
+	GetRecordedISBN(context.Context, time.Time) ([]string, error)
+	GetRecordedBooks(context.Context, time.Time) (map[string]*models.RecordedBook, error)
+}
+
+// Recorder looks up the recorded books in Recorded, so that the books recorded already are not regarded as new.
+// When Recorded is nil or the lookup fails, every book is regarded as new, as told in the report.
+type Recorder struct {
+	Recorded RecordedLookup
+
+	mu           sync.Mutex
+	books        []*models.Book
+	lookupFailed bool
+}
+
+func (r *Recorder) GetRecordedISBN(ctx context.Context, targetDate time.Time) ([]string, error) {
+	if r.Recorded == nil {
+		return []string{}, nil
+	}
+	recordedISBN, err := r.Recorded.GetRecordedISBN(ctx, targetDate)
+	if err != nil {
+		log.Printf("[dry run] Cannot look up the recorded books, regarding every book as new: %s", err)
+		r.mu.Lock()
+		r.lookupFailed = true
+		r.mu.Unlock()
+		return []string{}, nil
+	}
+	return recordedISBN, nil
+}
+
+// GetRecordedBooks looks up the latest records of the books in Recorded,
+// so that the updates of the books recorded on an earlier day are reported as well.
+func (r *Recorder) GetRecordedBooks(ctx context.Context, targetDate time.Time) (map[string]*models.RecordedBook, error) {
+	if r.Recorded == nil {
+		return map[string]*models.RecordedBook{}, nil
+	}
+	recordedBooks, err := r.Recorded.GetRecordedBooks(ctx, targetDate)
+	if err != nil {
+		log.Printf("[dry run] Cannot look up the recorded books, regarding every book as new: %s", err)
+		r.mu.Lock()
+		r.lookupFailed = true
+		r.mu.Unlock()
+		return map[string]*models.RecordedBook{}, nil
+	}
+	return recordedBooks, nil
+}
+
+// LookedUp tells whether the books recorded already were excluded from the new books.
+func (r *Recorder) LookedUp() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Recorded != nil && !r.lookupFailed
+}
+
+func (r *Recorder) SaveRecords(ctx context.Context, bookList *models.BookList) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	log.Printf("[dry run] Would record %d book(s) uploaded at %s", len(bookList.Books), bookList.UploadDate)
+	r.books = append(r.books, bookList.Books...)
+	return nil
+}
+
+func (r *Recorder) Books() []*models.Book {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*models.Book{}, r.books...)
+}
+
+// DeliveryLookup looks up the deliveries tracked by the configured tracker, opened read-only.
+type DeliveryLookup interface {
+	GetDeliveries(context.Context) (map[string]*models.Delivery, error)
+}
+
+// Tracker looks up the deliveries in Tracked, so that the books notified already are skipped
+// and the undelivered ones are retried as in a real run. The deliveries are not saved.
+// When the lookup fails, no book is regarded as notified, as told in the report.
+type Tracker struct {
+	Tracked DeliveryLookup
+
+	mu           sync.Mutex
+	lookupFailed bool
+}
+
+func (t *Tracker) GetDeliveries(ctx context.Context) (map[string]*models.Delivery, error) {
+	deliveries, err := t.Tracked.GetDeliveries(ctx)
+	if err != nil {
+		log.Printf("[dry run] Cannot look up the deliveries, regarding no book as notified: %s", err)
+		t.mu.Lock()
+		t.lookupFailed = true
+		t.mu.Unlock()
+		return map[string]*models.Delivery{}, nil
+	}
+	return deliveries, nil
+}
+
+func (t *Tracker) SaveDelivery(ctx context.Context, delivery *models.Delivery) error {
+	return nil
+}
+
+// LookedUp tells whether the deliveries of the earlier runs were taken into account.
+func (t *Tracker) LookedUp() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.lookupFailed
+}
+
+type Uploader struct {
+	mu      sync.Mutex
+	objects []*uploader.UploadObject
+}
+
+func (u *Uploader) Upload(object *uploader.UploadObject) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	log.Printf("[dry run] Would upload %s (%d bytes)", object.ObjectName, len(object.Binary))
+	u.objects = append(u.objects, object)
+	return nil
+}
+
+func (u *Uploader) Objects() []*uploader.UploadObject {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]*uploader.UploadObject{}, u.objects...)
+}
+
+// Explainer is implemented by filters which can tell the condition blocks a book matches.
+type Explainer interface {
+	IsFavorite(*models.Book) bool
+	MatchedBlocks(*models.Book) []string
+}
+
+// WriteReport writes the books which would be recorded with the filter blocks they match,
+// the messages which would be sent and the objects which would be uploaded.
+// tracker may be nil when the deliveries are not tracked,
+// and explainer may be nil when the filter cannot tell the matched blocks.
+func WriteReport(w io.Writer, recorder *Recorder, notifier *Notifier, tracker *Tracker, objectUploader *Uploader, explainer Explainer) error {
+
+	var b strings.Builder
+
+	books := recorder.Books()
+	fmt.Fprintf(&b, "=== Dry run report ===\n")
+	fmt.Fprintf(&b, "New books: %d\n", len(books))
+	if !recorder.LookedUp() {
+		fmt.Fprintf(&b, "(the recorder could not be reached; every book is regarded as new)\n")
+	}
+	for _, book := range books {
+		fmt.Fprintf(&b, "- %s %s\n", book.Isbn, book.Title)
+		if explainer == nil {
+			continue
+		}
+		matchedBlocks := explainer.MatchedBlocks(book)
+		if len(matchedBlocks) == 0 {
+			matchedBlocks = []string{"(none)"}
+		}
+		fmt.Fprintf(&b, "    favorite: %t, matched blocks: %s\n", explainer.IsFavorite(book), strings.Join(matchedBlocks, " / "))
+	}
+
+	messages := notifier.Messages()
+	fmt.Fprintf(&b, "Notifications: %d\n", len(messages))
+	if tracker != nil && !tracker.LookedUp() {
+		fmt.Fprintf(&b, "(the tracker could not be reached; no book is regarded as notified)\n")
+	}
+	for i, message := range messages {
+		fmt.Fprintf(&b, "--- %d ---\n%s\n", i+1, message)
+	}
+
+	if objectUploader != nil {
+		objects := objectUploader.Objects()
+		fmt.Fprintf(&b, "Uploads: %d\n", len(objects))
+		for _, object := range objects {
+			fmt.Fprintf(&b, "- %s (%d bytes)\n", object.ObjectName, len(object.Binary))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
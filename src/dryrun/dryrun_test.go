@@ -0,0 +1,165 @@
+package dryrun
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/new-books-notification/src/models"
+	"github.com/tatamiya/new-books-notification/src/uploader"
+)
+
+type explainerStub struct{}
+
+func (e *explainerStub) IsFavorite(book *models.Book) bool {
+	return book.Categories == "自然科学"
+}
+
+func (e *explainerStub) MatchedBlocks(book *models.Book) []string {
+	if book.Categories == "自然科学" {
+		return []string{"カテゴリが自然科学", "学参は除外"}
+	}
+	return nil
+}
+
+type lookupStub struct {
+	RecordedISBN  []string
+	RecordedBooks map[string]*models.RecordedBook
+	IsError       bool
+}
+
+func (l *lookupStub) GetRecordedISBN(ctx context.Context, targetDate time.Time) ([]string, error) {
+	if l.IsError {
+		return nil, fmt.Errorf("Cannot connect!")
+	}
+	return l.RecordedISBN, nil
+}
+
+func (l *lookupStub) GetRecordedBooks(ctx context.Context, targetDate time.Time) (map[string]*models.RecordedBook, error) {
+	if l.IsError {
+		return nil, fmt.Errorf("Cannot connect!")
+	}
+	return l.RecordedBooks, nil
+}
+
+type deliveryLookupStub struct {
+	Deliveries map[string]*models.Delivery
+	IsError    bool
+}
+
+func (d *deliveryLookupStub) GetDeliveries(ctx context.Context) (map[string]*models.Delivery, error) {
+	if d.IsError {
+		return nil, fmt.Errorf("Cannot connect!")
+	}
+	return d.Deliveries, nil
+}
+
+func TestWriteReportListsBooksMessagesAndUploads(t *testing.T) {
+	testRecorder := Recorder{Recorded: &lookupStub{RecordedISBN: []string{}}}
+	testNotifier := Notifier{}
+	testUploader := Uploader{}
+
+	inputBookList := models.BookList{
+		Books: []*models.Book{
+			{Isbn: "1111111111111", Title: "Book1", Categories: "自然科学"},
+			{Isbn: "2222222222222", Title: "Book2", Categories: "文学"},
+		},
+	}
+	recordedISBN, err := testRecorder.GetRecordedISBN(context.Background(), inputBookList.UploadDate)
+	assert.Nil(t, err)
+	assert.Empty(t, recordedISBN)
+	assert.Nil(t, testRecorder.SaveRecords(context.Background(), &inputBookList))
+	assert.Nil(t, testNotifier.Post("Book1"))
+	assert.Nil(t, testUploader.Upload(&uploader.UploadObject{ObjectName: "feed20240801.json", Binary: []byte("{}")}))
+
+	var actualReport strings.Builder
+	err = WriteReport(&actualReport, &testRecorder, &testNotifier, nil, &testUploader, &explainerStub{})
+
+	expectedReport := `=== Dry run report ===
+New books: 2
+- 1111111111111 Book1
+    favorite: true, matched blocks: カテゴリが自然科学 / 学参は除外
+- 2222222222222 Book2
+    favorite: false, matched blocks: (none)
+Notifications: 1
+--- 1 ---
+Book1
+Uploads: 1
+- feed20240801.json (2 bytes)
+`
+	assert.Nil(t, err)
+	assert.Equal(t, expectedReport, actualReport.String())
+}
+
+func TestRecorderLooksUpRecordedBooks(t *testing.T) {
+	testRecorder := Recorder{Recorded: &lookupStub{RecordedISBN: []string{"1111111111111"}}}
+
+	recordedISBN, err := testRecorder.GetRecordedISBN(context.Background(), time.Now())
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"1111111111111"}, recordedISBN)
+	assert.True(t, testRecorder.LookedUp())
+}
+
+func TestRecorderLooksUpLatestRecordsOfBooks(t *testing.T) {
+	yesterday := time.Date(2024, time.August, 1, 22, 42, 0, 0, time.UTC)
+	testRecorder := Recorder{Recorded: &lookupStub{RecordedBooks: map[string]*models.RecordedBook{
+		"1111111111111": {Isbn: "1111111111111", Title: "Book1", UploadedDate: yesterday},
+	}}}
+
+	recordedBooks, err := testRecorder.GetRecordedBooks(context.Background(), yesterday.AddDate(0, 0, 1))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Book1", recordedBooks["1111111111111"].Title)
+	assert.True(t, testRecorder.LookedUp())
+
+	testRecorder = Recorder{Recorded: &lookupStub{IsError: true}}
+	recordedBooks, err = testRecorder.GetRecordedBooks(context.Background(), yesterday.AddDate(0, 0, 1))
+	assert.Nil(t, err)
+	assert.Empty(t, recordedBooks)
+	assert.False(t, testRecorder.LookedUp())
+}
+
+func TestTrackerLooksUpDeliveriesWithoutSaving(t *testing.T) {
+	tracked := deliveryLookupStub{Deliveries: map[string]*models.Delivery{
+		"1111111111111": {ISBN: "1111111111111", Status: models.DeliveryFailed, Message: "Book1"},
+	}}
+	testTracker := Tracker{Tracked: &tracked}
+
+	deliveries, err := testTracker.GetDeliveries(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, models.DeliveryFailed, deliveries["1111111111111"].Status)
+	assert.Nil(t, testTracker.SaveDelivery(context.Background(), &models.Delivery{ISBN: "1111111111111", Status: models.DeliverySent}))
+	assert.Equal(t, models.DeliveryFailed, tracked.Deliveries["1111111111111"].Status)
+
+	var actualReport strings.Builder
+	assert.Nil(t, WriteReport(&actualReport, &Recorder{}, &Notifier{}, &testTracker, nil, nil))
+	assert.NotContains(t, actualReport.String(), "tracker could not be reached")
+
+	failingTracker := Tracker{Tracked: &deliveryLookupStub{IsError: true}}
+	deliveries, err = failingTracker.GetDeliveries(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, deliveries)
+
+	actualReport.Reset()
+	assert.Nil(t, WriteReport(&actualReport, &Recorder{}, &Notifier{}, &failingTracker, nil, nil))
+	assert.Contains(t, actualReport.String(), "Notifications: 0\n(the tracker could not be reached; no book is regarded as notified)\n")
+}
+
+func TestWriteReportTellsEveryBookIsRegardedAsNewWithoutRecorder(t *testing.T) {
+	for _, testRecorder := range []*Recorder{
+		{},
+		{Recorded: &lookupStub{IsError: true}},
+	} {
+		recordedISBN, err := testRecorder.GetRecordedISBN(context.Background(), time.Now())
+		assert.Nil(t, err)
+		assert.Empty(t, recordedISBN)
+
+		var actualReport strings.Builder
+		assert.Nil(t, WriteReport(&actualReport, testRecorder, &Notifier{}, nil, nil, nil))
+		assert.Contains(t, actualReport.String(), "New books: 0\n(the recorder could not be reached; every book is regarded as new)\n")
+	}
+}
@@ -0,0 +1,85 @@
+package feeds
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Source is an RSS/Atom feed watched by the pipeline.
+// FilterPath optionally points to a notification filter applied only to the books of this source.
+type Source struct {
+	Name       string `yaml:"name"`
+	URL        string `yaml:"url"`
+	FilterPath string `yaml:"filter"`
+}
+
+type SourceFeed struct {
+	Source Source
+	Feed   *gofeed.Feed
+}
+
+// FetchAll fetches the feeds of the sources concurrently.
+// The feeds fetched successfully are returned in the order of the sources,
+// together with an error describing the sources which failed.
+func FetchAll(sources []Source) ([]*SourceFeed, error) {
+
+	feeds := make([]*gofeed.Feed, len(sources))
+	errs := make([]error, len(sources))
+
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source Source) {
+
+			defer wg.Done()
+
+			fp := gofeed.NewParser()
+			feeds[i], errs[i] = fp.ParseURL(source.URL)
+
+		}(i, source)
+	}
+	wg.Wait()
+
+	var sourceFeeds []*SourceFeed
+	var failures []string
+	for i, source := range sources {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", source.Name, errs[i]))
+			continue
+		}
+		sourceFeeds = append(sourceFeeds, &SourceFeed{Source: source, Feed: feeds[i]})
+	}
+
+	if len(failures) > 0 {
+		return sourceFeeds, fmt.Errorf("could not get %d of %d feed(s): %s", len(failures), len(sources), strings.Join(failures, "; "))
+	}
+	return sourceFeeds, nil
+}
+
+// Segments of hanmoto search URLs which limit the results to the books published and registered today.
+var todaySegments = []string{"/sdate/today/", "/created/today/"}
+
+const searchDateLayout = "2006-01-02"
+
+// ForDate returns the source searching the books published and registered on the date instead of today.
+// It fails when the URL has no date segment to replace.
+func (s Source) ForDate(date time.Time) (Source, error) {
+
+	replaced := false
+	for _, segment := range todaySegments {
+		if strings.Contains(s.URL, segment) {
+			dateSegment := strings.Replace(segment, "today", date.Format(searchDateLayout), 1)
+			s.URL = strings.Replace(s.URL, segment, dateSegment, 1)
+			replaced = true
+		}
+	}
+	if !replaced {
+		return s, fmt.Errorf("feed URL of source %s has no date to replace: %s", s.Name, s.URL)
+	}
+
+	return s, nil
+}
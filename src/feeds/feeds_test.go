@@ -0,0 +1,73 @@
+package feeds
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>%s</title>
+<pubDate>Thu, 01 Aug 2024 22:42:00 +0900</pubDate>
+<item>
+<title>ご冗談でしょう、tatamiyaさん</title>
+<link>http://example.com/bd/isbn/1111111111111</link>
+<pubDate>Sat, 31 Aug 2024 12:13:24 +0900</pubDate>
+</item>
+</channel>
+</rss>`
+
+func TestFetchAllReturnsFeedsInOrderOfSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, sampleRSS, r.URL.Path)
+	}))
+	defer server.Close()
+
+	inputSources := []Source{
+		{Name: "publisher", URL: server.URL + "/publisher"},
+		{Name: "broken", URL: server.URL + "/broken"},
+		{Name: "genre", URL: server.URL + "/genre"},
+	}
+
+	actualSourceFeeds, err := FetchAll(inputSources)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, len(actualSourceFeeds))
+	assert.Equal(t, "publisher", actualSourceFeeds[0].Source.Name)
+	assert.Equal(t, "/publisher", actualSourceFeeds[0].Feed.Title)
+	assert.Equal(t, "genre", actualSourceFeeds[1].Source.Name)
+	assert.Equal(t, "/genre", actualSourceFeeds[1].Feed.Title)
+}
+
+func TestSourceForDateReplacesTodaySegments(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	inputDate := time.Date(2024, time.August, 1, 0, 0, 0, 0, loc)
+	inputSource := Source{
+		Name: "hanmoto",
+		URL:  "https://www.hanmoto.com/ci/bd/search/hdt/new/sdate/today/created/today/order/desc/vw/rss20",
+	}
+
+	actualSource, err := inputSource.ForDate(inputDate)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.hanmoto.com/ci/bd/search/hdt/new/sdate/2024-08-01/created/2024-08-01/order/desc/vw/rss20", actualSource.URL)
+	assert.Equal(t, "https://www.hanmoto.com/ci/bd/search/hdt/new/sdate/today/created/today/order/desc/vw/rss20", inputSource.URL)
+}
+
+func TestSourceForDateFailsWithoutTodaySegments(t *testing.T) {
+	inputSource := Source{Name: "static", URL: "https://example.com/feed.rss"}
+
+	_, err := inputSource.ForDate(time.Now())
+
+	assert.NotNil(t, err)
+}
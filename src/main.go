@@ -3,17 +3,25 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"path"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/mmcdole/gofeed"
 	"github.com/tatamiya/new-books-notification/src/config"
 	"github.com/tatamiya/new-books-notification/src/details"
+	"github.com/tatamiya/new-books-notification/src/dryrun"
+	"github.com/tatamiya/new-books-notification/src/feeds"
 	"github.com/tatamiya/new-books-notification/src/models"
 	"github.com/tatamiya/new-books-notification/src/notifier"
 	"github.com/tatamiya/new-books-notification/src/recorder"
@@ -25,138 +33,686 @@ type Recorder interface {
 	SaveRecords(context.Context, *models.BookList) error
 }
 
+// RecordedBookLookup is implemented by recorders which can tell the latest records of the books,
+// so that a book recorded on an earlier day can be notified again when its metadata is updated.
+type RecordedBookLookup interface {
+	GetRecordedBooks(context.Context, time.Time) (map[string]*models.RecordedBook, error)
+}
+
 type Notifier interface {
 	Post(string) error
 }
 
+// NotificationTracker keeps the deliveries to the channel of the notifier,
+// so that a book is notified once even if the run is repeated or fails to record it.
+type NotificationTracker interface {
+	GetDeliveries(context.Context) (map[string]*models.Delivery, error)
+	SaveDelivery(context.Context, *models.Delivery) error
+}
+
 type Filter interface {
 	IsFavorite(*models.Book) bool
 }
 
+type Uploader interface {
+	Upload(*uploader.UploadObject) error
+}
+
+// FeedArchive is an Uploader from which the uploaded feeds can be read back.
+type FeedArchive interface {
+	Uploader
+	archiveReader
+}
+
 type DetailFetcher interface {
 	FetchDetailInfo(string) (*details.DetailedInformation, error)
 }
 
+type BatchDetailFetcher interface {
+	FetchDetailInfoBatch([]string) (map[string]*details.DetailedInformation, error)
+}
+
 func coreProcess(
 	bookList *models.BookList,
 	fetcher DetailFetcher,
 	recorder Recorder,
 	filter Filter,
 	notifier Notifier,
-) int {
+	tracker NotificationTracker,
+	notifyUpdates bool,
+	maxConcurrency int,
+) *RunResult {
 
 	ctx := context.Background()
+	result := RunResult{}
+
+	deliveries := map[string]*models.Delivery{}
+	if tracker != nil {
+		trackedDeliveries, err := tracker.GetDeliveries(ctx)
+		if err != nil {
+			log.Printf("Cannot fetch deliveries of notifications: %s", err)
+		} else {
+			deliveries = trackedDeliveries
+		}
+		result.count(&result.Tracking, err)
+	}
+	// notify posts the message unless it was sent to the channel before. name describes the book in the log.
+	notify := func(isbn string, name string, message string) {
+		if delivery, ok := deliveries[isbn]; ok && delivery.Status == models.DeliverySent {
+			log.Printf("Skipping %s already notified", name)
+			result.increment(&result.AlreadyNotified)
+			return
+		}
+		saveDelivery := func(status models.DeliveryStatus) {
+			if tracker == nil {
+				return
+			}
+			err := tracker.SaveDelivery(ctx, &models.Delivery{ISBN: isbn, Status: status, Message: message})
+			if err != nil {
+				log.Printf("Cannot save delivery of %s: %s", name, err)
+			}
+			result.count(&result.Tracking, err)
+		}
 
+		saveDelivery(models.DeliveryPending)
+		err := notifier.Post(message)
+		if err != nil {
+			log.Printf("Error in notifying %s to Slack: %s\n", name, err)
+			saveDelivery(models.DeliveryFailed)
+		} else {
+			saveDelivery(models.DeliverySent)
+		}
+		result.count(&result.Notification, err)
+	}
+
+	// Books recorded on an earlier day in the dedup window are processed again as update candidates
+	// when notifyUpdates is set, and recorded again only if their important fields have changed.
 	var newBookList *models.BookList
+	updateCandidates := map[string]*models.RecordedBook{}
+	lookup, canLookup := recorder.(RecordedBookLookup)
 	if recorder == nil {
 		newBookList = bookList
+	} else if notifyUpdates && canLookup {
+		recordedBooks, err := lookup.GetRecordedBooks(ctx, bookList.UploadDate)
+		if err != nil {
+			log.Printf("Cannot fetch recorded books from BigQuery: %s", err)
+		}
+		result.count(&result.Lookup, err)
+		var uploadedISBN []string
+		targetDate := bookList.UploadDate.Format("2006-01-02")
+		for isbn, recordedBook := range recordedBooks {
+			if recordedBook.UploadedDate.Format("2006-01-02") == targetDate {
+				uploadedISBN = append(uploadedISBN, isbn)
+			} else {
+				updateCandidates[isbn] = recordedBook
+			}
+		}
+		newBookList = bookList.FilterOut(uploadedISBN)
 	} else {
 		uploadedISBN, err := recorder.GetRecordedISBN(ctx, bookList.UploadDate)
 		if err != nil {
 			log.Printf("Cannot fetch ISBNs of uploaded books from BigQuery: %s", err)
 		}
+		result.count(&result.Lookup, err)
 		newBookList = bookList.FilterOut(uploadedISBN)
 	}
+	newISBN := make(map[string]bool)
+	for _, book := range newBookList.Books {
+		if _, ok := updateCandidates[book.Isbn]; !ok {
+			newISBN[book.Isbn] = true
+		}
+	}
+	result.NewBooks = len(newISBN)
+
+	var mu sync.Mutex
+	unchangedISBN := []string{}
 
+	fetchDetailInfo := fetcher.FetchDetailInfo
+	if batchFetcher, ok := fetcher.(BatchDetailFetcher); ok {
+		fetchDetailInfo = prefetchDetailInfo(batchFetcher, newBookList)
+	}
+
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+	bookQueue := make(chan *models.Book)
 	var wg sync.WaitGroup
-	for _, book := range newBookList.Books {
+	for i := 0; i < maxConcurrency; i++ {
 		wg.Add(1)
-		go func(book *models.Book) {
+		go func() {
 
 			defer wg.Done()
 
-			detailedInfo, err := fetcher.FetchDetailInfo(book.Isbn)
-			if err != nil {
-				log.Printf("Cannot fetch data from OpenBD (%s, %s): %s", book.Isbn, book.Title, err)
-			} else if detailedInfo == nil {
-				log.Printf("Response from OpenBD is empty (%s, %s)", book.Isbn, book.Title)
-			} else {
-				book.UpdateDetails(detailedInfo)
-			}
-
-			if filter.IsFavorite(book) {
-				err = notifier.Post(book.AsNotificationMessage())
+			for book := range bookQueue {
+				detailedInfo, err := fetchDetailInfo(book.Isbn)
+				fetched := false
 				if err != nil {
-					log.Printf("Error in notifying %s(%s) to Slack: %s\n", book.Isbn, book.Title, err)
+					log.Printf("Cannot fetch data from OpenBD (%s, %s): %s", book.Isbn, book.Title, err)
+					result.count(&result.Details, err)
+				} else if detailedInfo == nil {
+					log.Printf("Response from OpenBD is empty (%s, %s)", book.Isbn, book.Title)
+					result.increment(&result.EmptyDetails)
+				} else {
+					book.UpdateDetails(detailedInfo)
+					result.count(&result.Details, nil)
+					fetched = true
 				}
-			}
 
-		}(book)
+				if recordedBook, ok := updateCandidates[book.Isbn]; ok {
+					// Without the details, e.g. failed to fetch or unknown to OpenBD, the book has the registration date of the feed
+					// instead of the publication date from OpenBD, so that it is regarded as unchanged.
+					var changes []models.FieldChange
+					if fetched {
+						changes = recordedBook.ChangedFields(book)
+					}
+					if len(changes) == 0 {
+						mu.Lock()
+						unchangedISBN = append(unchangedISBN, book.Isbn)
+						mu.Unlock()
+						continue
+					}
+					result.increment(&result.UpdatedBooks)
+					if filter.IsFavorite(book) {
+						// Updates are not tracked, since the book is notified once already; the record of today prevents a repeat.
+						err := notifier.Post(book.AsUpdateNotificationMessage(changes))
+						if err != nil {
+							log.Printf("Error in notifying update of %s(%s) to Slack: %s\n", book.Isbn, book.Title, err)
+						}
+						result.count(&result.Notification, err)
+					}
+					continue
+				}
+
+				if filter.IsFavorite(book) {
+					notify(book.Isbn, fmt.Sprintf("%s(%s)", book.Isbn, book.Title), book.AsNotificationMessage())
+				}
+			}
 
+		}()
+	}
+	for _, book := range newBookList.Books {
+		bookQueue <- book
 	}
+	close(bookQueue)
 	wg.Wait()
 
-	err := recorder.SaveRecords(ctx, newBookList)
-	if err != nil {
-		log.Printf("Cannot save newly arrived book records: %s", err)
+	// Notifications left pending or failed by the previous runs are sent again with their messages.
+	var retries []*models.Delivery
+	for isbn, delivery := range deliveries {
+		if !newISBN[isbn] && delivery.Status != models.DeliverySent {
+			retries = append(retries, delivery)
+		}
+	}
+	sort.Slice(retries, func(i, j int) bool { return retries[i].ISBN < retries[j].ISBN })
+	for _, delivery := range retries {
+		log.Printf("Retrying notification of %s left %s", delivery.ISBN, delivery.Status)
+		notify(delivery.ISBN, delivery.ISBN, delivery.Message)
 	}
 
-	return len(newBookList.Books)
+	booksToRecord := newBookList.FilterOut(unchangedISBN)
+	result.ProcessedBooks = booksToRecord
+	if recorder != nil {
+		err := recorder.SaveRecords(ctx, booksToRecord)
+		if err != nil {
+			log.Printf("Cannot save newly arrived book records: %s", err)
+			result.Recording.Failed = len(booksToRecord.Books)
+		} else {
+			result.Recording.Succeeded = len(booksToRecord.Books)
+		}
+	}
+
+	return &result
+
+}
+
+// prefetchDetailInfo fetches the details of all the books at once
+// and returns a lookup function which serves them from the fetched results.
+func prefetchDetailInfo(fetcher BatchDetailFetcher, bookList *models.BookList) func(string) (*details.DetailedInformation, error) {
 
+	var isbns []string
+	for _, book := range bookList.Books {
+		isbns = append(isbns, book.Isbn)
+	}
+
+	detailsByISBN, batchErr := fetcher.FetchDetailInfoBatch(isbns)
+	if batchErr != nil {
+		log.Printf("Batch request to OpenBD partially failed: %s", batchErr)
+	}
+
+	return func(isbn string) (*details.DetailedInformation, error) {
+		detailedInfo, ok := detailsByISBN[isbn]
+		if !ok {
+			return nil, fmt.Errorf("ISBN %s was not fetched: %s", isbn, batchErr)
+		}
+		return detailedInfo, nil
+	}
 }
 
 func main() {
-	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(config.FeedURL)
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+// runDaily is the "run" command, which processes the books registered today.
+func runDaily(args []string) int {
+
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print what would be notified, recorded and uploaded instead of doing it")
+	cfg, err := loadConfig(flags, args)
 	if err != nil {
-		log.Println("Could not get feed!")
-		panic(err)
+		log.Printf("Error in loading config: %s", err)
+		return exitSetupFailed
+	}
+	if !*dryRun {
+		if err := cfg.ValidateRecorder(); err != nil {
+			log.Printf("Error in loading config: %s", err)
+			return exitSetupFailed
+		}
 	}
 
-	bookList := models.NewBookListFromFeed(feed)
+	sourceFeeds, bookList, err := fetchBookList(cfg.Feeds)
+	if bookList == nil {
+		log.Printf("Could not get feed!: %s", err)
+		return exitSetupFailed
+	}
+	if err != nil {
+		log.Printf("Could not get some of the feeds: %s", err)
+	}
 	log.Println(bookList.UploadDate.String())
 
-	subjectDecoder, err := details.NewSubjectDecoder(config.CcodeJsonFilePath)
+	ctx := context.Background()
+	p, err := newPipeline(ctx, cfg, *dryRun, true)
 	if err != nil {
-		log.Println("Error in loading SubjectDecoder.")
-		panic(err)
+		log.Println(err)
+		return exitSetupFailed
 	}
-	detailFetcher := details.NewOpenBDDetailsFetcher(subjectDecoder)
+	defer p.close()
 
-	bqSettings := fetchBQSettings()
-	ctx := context.Background()
-	bqRecorder, err := recorder.NewBQRecorder(ctx, bqSettings)
+	result := coreProcess(bookList, p.fetcher, p.recorder, p.filter, p.notifier, p.tracker, p.notifyUpdates, p.maxConcurrency)
+
+	log.Printf("Reported %s", result)
+
+	if p.uploader != nil {
+		archiveRun(p.uploader, sourceFeeds, result.ProcessedBooks, len(cfg.Feeds) > 1, cfg.Uploader.PathTemplate, time.Now())
+	}
+	p.writeDryRunReport(os.Stdout)
+
+	return result.ExitCode(cfg.FailureThresholds.Recording, cfg.FailureThresholds.Notification)
+}
+
+// uploadFeeds archives the raw feeds, and returns the uploaded objects and the names of those failed.
+// Feeds which exist already and are not overwritten, e.g. on a re-run of the day, are regarded as uploaded.
+// withSourceName should be false for a single source so that it keeps the object name used before multiple sources were supported.
+func uploadFeeds(objectUploader Uploader, sourceFeeds []*feeds.SourceFeed, withSourceName bool, pathTemplate string) ([]*uploader.UploadObject, []string) {
+	var uploaded []*uploader.UploadObject
+	var failed []string
+	for _, sourceFeed := range sourceFeeds {
+		sourceName := ""
+		if withSourceName {
+			sourceName = sourceFeed.Source.Name
+		}
+		uploadFeed, err := generateJsonUploadObject(sourceFeed.Feed, sourceName, pathTemplate)
+		if err != nil {
+			log.Printf("Feed upload failed: %s", err)
+			failed = append(failed, fmt.Sprintf("feed of %s", sourceFeed.Source.Name))
+			continue
+		}
+		if err := objectUploader.Upload(uploadFeed); errors.Is(err, uploader.ErrObjectExists) {
+			log.Printf("Feed %s is archived already", uploadFeed.ObjectName)
+		} else if err != nil {
+			log.Printf("Feed upload failed: %s", err)
+			failed = append(failed, uploadFeed.ObjectName)
+			continue
+		}
+		uploaded = append(uploaded, uploadFeed)
+	}
+	return uploaded, failed
+}
+
+// fetchBookList fetches the feeds of the sources and merges their books into one list.
+// The list is nil only when none of the feeds could be fetched.
+func fetchBookList(sources []feeds.Source) ([]*feeds.SourceFeed, *models.BookList, error) {
+
+	sourceFeeds, err := feeds.FetchAll(sources)
+	if len(sourceFeeds) == 0 {
+		return nil, nil, fmt.Errorf("no feed is available: %v", err)
+	}
+
+	var bookLists []*models.BookList
+	for _, sourceFeed := range sourceFeeds {
+		sourceBookList := models.NewBookListFromFeed(sourceFeed.Feed)
+		sourceBookList.TagSource(sourceFeed.Source.Name)
+		bookLists = append(bookLists, sourceBookList)
+	}
+
+	return sourceFeeds, models.MergeBookLists(bookLists...), err
+}
+
+// pipeline holds the dependencies of coreProcess shared by the daily run and the other commands.
+// uploader is nil when the bucket is not available, and tracker is nil when the deliveries are not tracked.
+type pipeline struct {
+	fetcher        DetailFetcher
+	recorder       Recorder
+	filter         Filter
+	notifier       Notifier
+	tracker        NotificationTracker
+	uploader       Uploader
+	notifyUpdates  bool
+	maxConcurrency int
+
+	cachedFetcher *details.CachedDetailsFetcher
+	cacheStore    *details.JSONLinesCacheStore
+	// recorderConn is the connection of a recorder backend to be closed, if any.
+	recorderConn io.Closer
+
+	dryRunRecorder *dryrun.Recorder
+	dryRunNotifier *dryrun.Notifier
+	dryRunTracker  *dryrun.Tracker
+	dryRunUploader *dryrun.Uploader
+}
+
+// newPipeline builds the dependencies from the config.
+// In a dry run, the recorder, notifier and uploader only keep and log what would be done,
+// and the recorded books and the deliveries are looked up in the recorder opened read-only, if it can be reached.
+// Without notify, notifications are discarded and Slack need not be configured.
+func newPipeline(ctx context.Context, cfg *config.Config, dryRun bool, notify bool) (*pipeline, error) {
+
+	detailFetcher, err := newDetailFetcher(cfg)
 	if err != nil {
-		log.Println("Error in connecting to BigQuery.")
-		panic(err)
+		return nil, err
 	}
 
-	favFilter, err := notifier.NewNotificationFilter(config.FilterSettingFilePath)
+	favFilter, err := loadSourceFilter(cfg.Filter.Path, cfg.Feeds)
 	if err != nil {
-		log.Println("Error in loading notification filter.")
-		panic(err)
+		return nil, fmt.Errorf("error in loading notification filter: %s", err)
+	}
+
+	p := pipeline{
+		fetcher:        detailFetcher,
+		filter:         favFilter,
+		notifyUpdates:  cfg.Recorder.Dedup.NotifyUpdates,
+		maxConcurrency: cfg.Fetcher.MaxConcurrency,
+	}
+
+	if dryRun {
+		p.dryRunRecorder = &dryrun.Recorder{}
+		recorded, tracked, recorderConn, err := newReadOnlyRecorder(ctx, cfg, notify)
+		if err != nil {
+			log.Printf("Cannot connect to the recorder, regarding every book as new: %s", err)
+		} else {
+			p.dryRunRecorder.Recorded = recorded
+			p.recorderConn = recorderConn
+		}
+		if tracked != nil {
+			p.dryRunTracker = &dryrun.Tracker{Tracked: tracked}
+			p.tracker = p.dryRunTracker
+		}
+		p.dryRunNotifier = &dryrun.Notifier{}
+		p.dryRunUploader = &dryrun.Uploader{}
+		p.recorder = p.dryRunRecorder
+		p.notifier = p.dryRunNotifier
+		p.uploader = p.dryRunUploader
+	} else {
+		p.notifier = nopNotifier{}
+		if notify {
+			slackNotifier, err := notifier.NewSlackNotifier(cfg.Notifier.Slack.WebhookURL, cfg.Notifier.Slack.RequestsPerSecond)
+			if err != nil {
+				return nil, fmt.Errorf("error in loading SlackNotifier: %s", err)
+			}
+			p.notifier = slackNotifier
+		}
+
+		// Deliveries are not tracked for discarded notifications, which would be regarded as sent.
+		p.recorder, p.tracker, p.recorderConn, err = newRecorder(ctx, cfg, notify)
+		if err != nil {
+			return nil, err
+		}
+
+		objectUploader, uploaderErr := newFeedArchive(ctx, cfg)
+		if uploaderErr != nil {
+			log.Printf("Cannot create feed uploader: %s", uploaderErr)
+		} else {
+			p.uploader = objectUploader
+		}
 	}
 
-	webhookURL := os.Getenv("SLACK_WEBHOOK_URL")
-	slackNotifier, notifierErr := notifier.NewSlackNotifier(webhookURL)
-	if notifierErr != nil {
-		log.Println("Error in loading SlackNotifier.")
+	// The cache is opened last so that it is not left open when the other dependencies fail.
+	p.cachedFetcher, p.cacheStore = openDetailCache(detailFetcher, cfg)
+	if p.cachedFetcher != nil {
+		p.fetcher = p.cachedFetcher
 	}
 
-	numUploaded := coreProcess(bookList, detailFetcher, bqRecorder, favFilter, slackNotifier)
+	return &p, nil
+}
+
+// newRecorder connects to the recorder backend of the config, and to the notification tracker
+// in the same backend when tracked is set and the tracking is enabled.
+// The returned closer is nil for backends without a connection to close.
+func newRecorder(ctx context.Context, cfg *config.Config, tracked bool) (Recorder, NotificationTracker, io.Closer, error) {
 
-	log.Printf("Reported %d new book(s)", numUploaded)
+	tracking := cfg.Notifier.Tracking
+	tracked = tracked && tracking.Table != ""
 
-	bucketName := os.Getenv("GCS_BUCKET_NAME")
-	objectUploader, uploaderErr := uploader.NewGCSUploader(ctx, bucketName, "")
-	if uploaderErr != nil {
-		log.Printf("Cannot create feed uploader: %s", uploaderErr)
+	switch cfg.Recorder.Type {
+	case "sqlite":
+		sqliteRecorder, err := recorder.NewSQLiteRecorder(cfg.Recorder.SQLite.Path, cfg.Recorder.Dedup.WindowDays)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var tracker NotificationTracker
+		if tracked {
+			sqliteTracker, err := sqliteRecorder.NotificationTracker(ctx, tracking.Table, tracking.Channel, tracking.RetryWindow)
+			if err != nil {
+				sqliteRecorder.Close()
+				return nil, nil, nil, fmt.Errorf("error in connecting to the notification tracker: %s", err)
+			}
+			tracker = sqliteTracker
+		}
+		return sqliteRecorder, tracker, sqliteRecorder, nil
+	case "postgres":
+		postgresRecorder, err := recorder.NewPostgresRecorder(ctx, &recorder.PostgresSettings{
+			DSN:             cfg.Recorder.Postgres.DSN,
+			MaxOpenConns:    cfg.Recorder.Postgres.MaxOpenConns,
+			MaxIdleConns:    cfg.Recorder.Postgres.MaxIdleConns,
+			ConnMaxLifetime: cfg.Recorder.Postgres.ConnMaxLifetime,
+			DedupWindowDays: cfg.Recorder.Dedup.WindowDays,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var tracker NotificationTracker
+		if tracked {
+			postgresTracker, err := postgresRecorder.NotificationTracker(ctx, tracking.Table, tracking.Channel, tracking.RetryWindow)
+			if err != nil {
+				postgresRecorder.Close()
+				return nil, nil, nil, fmt.Errorf("error in connecting to the notification tracker: %s", err)
+			}
+			tracker = postgresTracker
+		}
+		return postgresRecorder, tracker, postgresRecorder, nil
+	default:
+		bqRecorder, err := recorder.NewBQRecorder(ctx, newBQSettings(cfg))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error in connecting to BigQuery: %s", err)
+		}
+		var tracker NotificationTracker
+		if tracked {
+			trackerSettings := newBQSettings(cfg)
+			trackerSettings.TableName = tracking.Table
+			bqTracker, err := recorder.NewBQNotificationTracker(ctx, trackerSettings, tracking.Channel, tracking.RetryWindow)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("error in connecting to the notification tracker: %s", err)
+			}
+			tracker = bqTracker
+		}
+		return bqRecorder, tracker, nil, nil
+	}
+}
+
+// newReadOnlyRecorder connects to the recorder backend of the config only to look up the recorded books,
+// and the deliveries when tracked is set and the tracking is enabled, without creating or migrating its tables.
+// The delivery lookup is nil when the deliveries are not tracked.
+func newReadOnlyRecorder(ctx context.Context, cfg *config.Config, tracked bool) (dryrun.RecordedLookup, dryrun.DeliveryLookup, io.Closer, error) {
+
+	tracking := cfg.Notifier.Tracking
+	tracked = tracked && tracking.Table != ""
+
+	switch cfg.Recorder.Type {
+	case "sqlite":
+		sqliteRecorder, err := recorder.NewReadOnlySQLiteRecorder(cfg.Recorder.SQLite.Path, cfg.Recorder.Dedup.WindowDays)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var tracker dryrun.DeliveryLookup
+		if tracked {
+			sqliteTracker, err := sqliteRecorder.NotificationTracker(ctx, tracking.Table, tracking.Channel, tracking.RetryWindow)
+			if err != nil {
+				log.Printf("Cannot connect to the notification tracker, regarding no book as notified: %s", err)
+			} else {
+				tracker = sqliteTracker
+			}
+		}
+		return sqliteRecorder, tracker, sqliteRecorder, nil
+	case "postgres":
+		postgresRecorder, err := recorder.NewPostgresRecorder(ctx, &recorder.PostgresSettings{
+			DSN:             cfg.Recorder.Postgres.DSN,
+			DedupWindowDays: cfg.Recorder.Dedup.WindowDays,
+			ReadOnly:        true,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var tracker dryrun.DeliveryLookup
+		if tracked {
+			postgresTracker, err := postgresRecorder.NotificationTracker(ctx, tracking.Table, tracking.Channel, tracking.RetryWindow)
+			if err != nil {
+				log.Printf("Cannot connect to the notification tracker, regarding no book as notified: %s", err)
+			} else {
+				tracker = postgresTracker
+			}
+		}
+		return postgresRecorder, tracker, postgresRecorder, nil
+	default:
+		settings := newBQSettings(cfg)
+		settings.ReadOnly = true
+		bqRecorder, err := recorder.NewBQRecorder(ctx, settings)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error in connecting to BigQuery: %s", err)
+		}
+		var tracker dryrun.DeliveryLookup
+		if tracked {
+			trackerSettings := newBQSettings(cfg)
+			trackerSettings.TableName = tracking.Table
+			trackerSettings.ReadOnly = true
+			bqTracker, err := recorder.NewBQNotificationTracker(ctx, trackerSettings, tracking.Channel, tracking.RetryWindow)
+			if err != nil {
+				// The recorded books are still looked up, as the tracker table is missing until the first tracked run.
+				log.Printf("Cannot connect to the notification tracker, regarding no book as notified: %s", err)
+			} else {
+				tracker = bqTracker
+			}
+		}
+		return bqRecorder, tracker, nil, nil
+	}
+}
+
+// newFeedArchive connects to the archive backend of the config.
+func newFeedArchive(ctx context.Context, cfg *config.Config) (FeedArchive, error) {
+
+	switch cfg.Uploader.Type {
+	case "local":
+		localUploader, err := uploader.NewLocalUploader(cfg.Uploader.Local.Directory, cfg.Uploader.Local.MaxRuns)
+		if err != nil {
+			return nil, err
+		}
+		return localUploader, nil
+	case "s3":
+		s3Uploader, err := uploader.NewS3Uploader(&uploader.S3Settings{
+			Endpoint:        cfg.Uploader.S3.Endpoint,
+			Region:          cfg.Uploader.S3.Region,
+			Bucket:          cfg.Uploader.S3.Bucket,
+			AccessKeyID:     cfg.Uploader.S3.AccessKeyID,
+			SecretAccessKey: cfg.Uploader.S3.SecretAccessKey,
+		}, "")
+		if err != nil {
+			return nil, err
+		}
+		return s3Uploader, nil
+	default:
+		gcsUploader, err := uploader.NewGCSUploader(ctx, &uploader.GCSSettings{
+			BucketName:  cfg.Uploader.GCS.Bucket,
+			Checksum:    cfg.Uploader.GCS.Checksum,
+			NoOverwrite: cfg.Uploader.GCS.NoOverwrite,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return gcsUploader, nil
+	}
+}
+
+// newDetailFetcher builds the OpenBD fetcher with the code tables and the throttling of the config.
+func newDetailFetcher(cfg *config.Config) (*details.OpenBDDetailsFetcher, error) {
+
+	subjectDecoder, err := details.NewSubjectDecoder(cfg.Fetcher.CcodeTablePath, cfg.Fetcher.StrictCcode)
+	if err != nil {
+		return nil, fmt.Errorf("error in loading SubjectDecoder: %s", err)
+	}
+	ndcDecoder, err := details.NewNDCDecoder(cfg.Fetcher.NdcTablePath)
+	if err != nil {
+		return nil, fmt.Errorf("error in loading NDCDecoder: %s", err)
+	}
+
+	return details.NewOpenBDDetailsFetcher(
+		subjectDecoder,
+		details.WithBaseURL(cfg.Fetcher.OpenBD.BaseURL),
+		details.WithTimeout(cfg.Fetcher.OpenBD.Timeout),
+		details.WithUserAgent(cfg.Fetcher.OpenBD.UserAgent),
+		details.WithRequestsPerSecond(cfg.Fetcher.OpenBD.RequestsPerSecond),
+		details.WithNDCDecoder(ndcDecoder),
+	), nil
+}
+
+// writeDryRunReport writes what would have been done in a dry run. It does nothing otherwise.
+func (p *pipeline) writeDryRunReport(w io.Writer) {
+	if p.dryRunRecorder == nil {
+		return
+	}
+	explainer, _ := p.filter.(dryrun.Explainer)
+	if err := dryrun.WriteReport(w, p.dryRunRecorder, p.dryRunNotifier, p.dryRunTracker, p.dryRunUploader, explainer); err != nil {
+		log.Printf("Cannot write dry run report: %s", err)
+	}
+}
+
+// close reports the cache statistics and closes the cache file.
+func (p *pipeline) close() {
+	if p.recorderConn != nil {
+		if err := p.recorderConn.Close(); err != nil {
+			log.Printf("Cannot close recorder: %s", err)
+		}
+	}
+	if p.cachedFetcher == nil {
 		return
 	}
-	uploadFeed, err := generateJsonUploadObject(feed)
-	uploadErr := objectUploader.Upload(uploadFeed)
-	if uploadErr != nil {
-		log.Printf("Feed upload failed: %s", err)
+	stats := p.cachedFetcher.Stats()
+	log.Printf("Detail cache: %d hit(s), %d miss(es)", stats.Hits, stats.Misses)
+	if err := p.cacheStore.Close(); err != nil {
+		log.Printf("Cannot close detail cache: %s", err)
 	}
 }
 
-func generateJsonUploadObject(feed *gofeed.Feed) (*uploader.UploadObject, error) {
+// generateJsonUploadObject names the object by pathTemplate, with the source name, if any, before the extension,
+// e.g. "2024/08/feed20240801_genre.json".
+func generateJsonUploadObject(feed *gofeed.Feed, sourceName string, pathTemplate string) (*uploader.UploadObject, error) {
 	b, err := json.Marshal(feed)
 	if err != nil {
 
 		return nil, fmt.Errorf("failed in converting feed into JSON: %s", err)
 	}
-	feedJsonFilename := fmt.Sprintf("feed%s.json", feed.PublishedParsed.Format("20060102"))
+	feedJsonFilename := uploader.ExpandPathTemplate(pathTemplate, *feed.PublishedParsed)
+	if sourceName != "" {
+		ext := path.Ext(feedJsonFilename)
+		feedJsonFilename = fmt.Sprintf("%s_%s%s", strings.TrimSuffix(feedJsonFilename, ext), sourceName, ext)
+	}
 
 	uploadObject := uploader.UploadObject{
 		ObjectName:  feedJsonFilename,
@@ -167,19 +723,65 @@ func generateJsonUploadObject(feed *gofeed.Feed) (*uploader.UploadObject, error)
 	return &uploadObject, nil
 }
 
-func fetchBQSettings() *recorder.BQSettings {
+// loadSourceFilter loads the default notification filter and the filters of the sources which have their own.
+func loadSourceFilter(defaultFilterPath string, sources []feeds.Source) (*notifier.SourceFilter, error) {
 
-	projectID, err := getProjectID()
-	if err != nil || projectID == "" {
-		log.Printf("Cannot get projectID from metadata API: %s", err)
-		projectID = os.Getenv("GCP_PROJECT_ID")
+	defaultFilter, err := notifier.NewNotificationFilter(defaultFilterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceFilters := make(map[string]*notifier.NotificationFilter)
+	for _, source := range sources {
+		if source.FilterPath == "" {
+			continue
+		}
+		sourceFilter, err := notifier.NewNotificationFilter(source.FilterPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load filter of source %s: %s", source.Name, err)
+		}
+		sourceFilters[source.Name] = sourceFilter
+	}
+
+	return notifier.NewSourceFilter(defaultFilter, sourceFilters), nil
+}
+
+// newBQSettings looks up the project in the metadata server unless it is configured.
+func newBQSettings(cfg *config.Config) *recorder.BQSettings {
+
+	projectID := cfg.Recorder.BigQuery.ProjectID
+	if projectID == "" {
+		var err error
+		projectID, err = getProjectID()
+		if err != nil || projectID == "" {
+			log.Printf("Cannot get projectID from metadata API: %s", err)
+		}
 	}
 
 	return &recorder.BQSettings{
-		ProjectID:   projectID,
-		DatasetName: os.Getenv("GCP_BIGQUERY_DATASET"),
-		TableName:   os.Getenv("GCP_BIGQUERY_TABLE"),
+		ProjectID:       projectID,
+		DatasetName:     cfg.Recorder.BigQuery.Dataset,
+		TableName:       cfg.Recorder.BigQuery.Table,
+		DedupWindowDays: cfg.Recorder.Dedup.WindowDays,
+		Upsert:          cfg.Recorder.BigQuery.WriteMode == "upsert",
+	}
+}
+
+// openDetailCache wraps the fetcher with the on-disk cache if it is configured.
+// It returns nil when the cache is disabled or cannot be opened.
+func openDetailCache(fetcher details.Fetcher, cfg *config.Config) (*details.CachedDetailsFetcher, *details.JSONLinesCacheStore) {
+
+	if cfg.Fetcher.Cache.Path == "" {
+		return nil, nil
+	}
+
+	store, err := details.OpenJSONLinesCacheStore(cfg.Fetcher.Cache.Path, cfg.Fetcher.Cache.TTL)
+	if err != nil {
+		log.Printf("Cannot open detail cache, fetching without cache: %s", err)
+		return nil, nil
 	}
+
+	return details.NewCachedDetailsFetcher(fetcher, store, cfg.Fetcher.Cache.TTL), store
 }
 
 func getProjectID() (string, error) {
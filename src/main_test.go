@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tatamiya/new-books-notification/src/details"
 	"github.com/tatamiya/new-books-notification/src/models"
+	"github.com/tatamiya/new-books-notification/src/uploader"
 )
 
 func TestGenerateUploadObjectOfFeed(t *testing.T) {
@@ -20,11 +22,21 @@ func TestGenerateUploadObjectOfFeed(t *testing.T) {
 		Title:           "This is a Sample Feed!",
 	}
 
-	uploadObject, err := generateJsonUploadObject(&inputFeed)
+	uploadObject, err := generateJsonUploadObject(&inputFeed, "", uploader.DefaultPathTemplate)
 
 	assert.Nil(t, err)
 	assert.Equal(t, "feed20220701.json", uploadObject.ObjectName)
 	assert.Equal(t, "application/json", uploadObject.ContentType)
+
+	sourceUploadObject, err := generateJsonUploadObject(&inputFeed, "publisher", uploader.DefaultPathTemplate)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "feed20220701_publisher.json", sourceUploadObject.ObjectName)
+
+	nestedUploadObject, err := generateJsonUploadObject(&inputFeed, "publisher", "{yyyy}/{mm}/feed{yyyymmdd}.json")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "2022/07/feed20220701_publisher.json", nestedUploadObject.ObjectName)
 }
 
 type RecorderStub struct {
@@ -102,6 +114,25 @@ func (d *DetailFetcherStub) FetchDetailInfo(isbn string) (*details.DetailedInfor
 	return detail, nil
 }
 
+type BatchDetailFetcherStub struct {
+	DetailFetcherStub
+	BatchQueries [][]string
+}
+
+func (d *BatchDetailFetcherStub) FetchDetailInfoBatch(isbns []string) (map[string]*details.DetailedInformation, error) {
+	d.BatchQueries = append(d.BatchQueries, isbns)
+	if d.IsError {
+		return map[string]*details.DetailedInformation{}, fmt.Errorf("Could not get detailed information!")
+	}
+
+	detailsByISBN := map[string]*details.DetailedInformation{}
+	for _, isbn := range isbns {
+		detailsByISBN[isbn] = d.details[isbn]
+	}
+
+	return detailsByISBN, nil
+}
+
 func TestCoreProcessSkipsAlreadyUploadedBook(t *testing.T) {
 
 	loc, _ := time.LoadLocation("Asia/Tokyo")
@@ -162,9 +193,12 @@ func TestCoreProcessSkipsAlreadyUploadedBook(t *testing.T) {
 		&testRecorder,
 		&testFavoriteFilter,
 		&testNotifier,
+		nil,
+		false,
+		2,
 	)
 
-	assert.Equal(t, 3, numUploaded)
+	assert.Equal(t, 3, numUploaded.NewBooks)
 	assert.ElementsMatch(t, []string{"1111111111111", "2222222222222", "3333333333333", "4444444444444"}, testRecorder.RecordedISBN)
 
 }
@@ -228,6 +262,9 @@ func TestCoreProcessNotifyingFavoriteBooks(t *testing.T) {
 		&testRecorder,
 		&testFavoriteFilter,
 		&testNotifier,
+		nil,
+		false,
+		2,
 	)
 
 	assert.Equal(t, 2, len(testNotifier.Messages))
@@ -281,6 +318,9 @@ func TestCoreProcessSkipsNotifyingAlreadyUploadedFavoriteBooks(t *testing.T) {
 		&testRecorder,
 		&testFavoriteFilter,
 		&testNotifier,
+		nil,
+		false,
+		2,
 	)
 
 	assert.Equal(t, 1, len(testNotifier.Messages))
@@ -325,6 +365,9 @@ func TestCoreProcessMakesNotificationWhenFetchedDetailIsEmpty(t *testing.T) {
 		&testRecorder,
 		&testFavoriteFilter,
 		&testNotifier,
+		nil,
+		false,
+		2,
 	)
 
 	assert.Equal(t, 1, len(testNotifier.Messages))
@@ -368,8 +411,545 @@ func TestCoreProcessMakesNotificationWhenFetchingDetailsFails(t *testing.T) {
 		&testRecorder,
 		&testFavoriteFilter,
 		&testNotifier,
+		nil,
+		false,
+		2,
+	)
+
+	assert.Equal(t, 1, len(testNotifier.Messages))
+
+}
+
+func TestCoreProcessFetchesDetailsInBatchWhenAvailable(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	dateUploaded := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	datePublished := time.Date(2024, time.September, 1, 22, 42, 0, 0, loc)
+	inputBookList := models.BookList{
+		UploadDate: dateUploaded,
+		Books: []*models.Book{
+			{
+				Isbn:       "1111111111111",
+				Title:      "Newly arrived book with favorite content",
+				Url:        "http://example.com/bd/isbn/1111111111111",
+				PubDate:    datePublished,
+				Categories: "趣味・実用",
+			},
+			{
+				Isbn:       "2222222222222",
+				Title:      "Already uploaded book",
+				Url:        "http://example.com/bd/isbn/2222222222222",
+				PubDate:    datePublished,
+				Categories: "趣味・実用",
+			},
+			{
+				Isbn:       "3333333333333",
+				Title:      "Newly arrived book with unfavorite content",
+				Url:        "http://example.com/bd/isbn/3333333333333",
+				PubDate:    datePublished,
+				Categories: "趣味・実用",
+			},
+		},
+	}
+
+	testRecorder := RecorderStub{
+		RecordedISBN: []string{"2222222222222"},
+		IsError:      false,
+	}
+	testDetailFetcher := BatchDetailFetcherStub{
+		DetailFetcherStub: DetailFetcherStub{
+			details: map[string]*details.DetailedInformation{
+				"1111111111111": {Content: "物理学"},
+				"3333333333333": {Content: "その他の工業"},
+			},
+			IsError: false,
+		},
+	}
+	testNotifier := NotifierStub{
+		IsError: false,
+	}
+	testFavoriteFilter := FilterStub{
+		FavoriteContents: []string{"物理学"},
+	}
+
+	_ = coreProcess(
+		&inputBookList,
+		&testDetailFetcher,
+		&testRecorder,
+		&testFavoriteFilter,
+		&testNotifier,
+		nil,
+		false,
+		2,
 	)
 
+	assert.EqualValues(t, [][]string{{"1111111111111", "3333333333333"}}, testDetailFetcher.BatchQueries)
 	assert.Equal(t, 1, len(testNotifier.Messages))
+}
 
+func TestCoreProcessMakesNotificationWhenBatchFetchFails(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	dateUploaded := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	datePublished := time.Date(2024, time.September, 1, 22, 42, 0, 0, loc)
+	inputBookList := models.BookList{
+		UploadDate: dateUploaded,
+		Books: []*models.Book{
+			{
+				Isbn:       "1111111111111",
+				Title:      "Newly arrived book with favorite category",
+				Url:        "http://example.com/bd/isbn/1111111111111",
+				PubDate:    datePublished,
+				Categories: "自然科学",
+			},
+		},
+	}
+
+	testRecorder := RecorderStub{
+		IsError: false,
+	}
+	testDetailFetcher := BatchDetailFetcherStub{
+		DetailFetcherStub: DetailFetcherStub{
+			IsError: true,
+		},
+	}
+	testNotifier := NotifierStub{
+		IsError: false,
+	}
+	testFavoriteFilter := FilterStub{
+		FavoriteCategories: []string{"自然科学"},
+	}
+
+	_ = coreProcess(
+		&inputBookList,
+		&testDetailFetcher,
+		&testRecorder,
+		&testFavoriteFilter,
+		&testNotifier,
+		nil,
+		false,
+		2,
+	)
+
+	assert.Equal(t, 1, len(testNotifier.Messages))
+}
+
+type ConcurrencyCountingFetcherStub struct {
+	mu             sync.Mutex
+	running        int
+	MaxConcurrency int
+}
+
+func (d *ConcurrencyCountingFetcherStub) FetchDetailInfo(isbn string) (*details.DetailedInformation, error) {
+	d.mu.Lock()
+	d.running++
+	if d.running > d.MaxConcurrency {
+		d.MaxConcurrency = d.running
+	}
+	d.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	d.mu.Lock()
+	d.running--
+	d.mu.Unlock()
+
+	return nil, nil
+}
+
+func TestCoreProcessLimitsConcurrency(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	dateUploaded := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	inputBookList := models.BookList{UploadDate: dateUploaded}
+	for i := 0; i < 10; i++ {
+		isbn := fmt.Sprintf("%013d", i)
+		inputBookList.Books = append(inputBookList.Books, &models.Book{
+			Isbn:  isbn,
+			Title: "Newly arrived book",
+			Url:   "http://example.com/bd/isbn/" + isbn,
+		})
+	}
+
+	testRecorder := RecorderStub{
+		IsError: false,
+	}
+	testDetailFetcher := ConcurrencyCountingFetcherStub{}
+	testNotifier := NotifierStub{
+		IsError: false,
+	}
+	testFavoriteFilter := FilterStub{}
+
+	numUploaded := coreProcess(
+		&inputBookList,
+		&testDetailFetcher,
+		&testRecorder,
+		&testFavoriteFilter,
+		&testNotifier,
+		nil,
+		false,
+		3,
+	)
+
+	assert.Equal(t, 10, numUploaded.NewBooks)
+	assert.LessOrEqual(t, testDetailFetcher.MaxConcurrency, 3)
+}
+
+func TestCoreProcessWithoutRecorderProcessesAllBooks(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	dateUploaded := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	inputBookList := models.BookList{
+		UploadDate: dateUploaded,
+		Books: []*models.Book{
+			{Isbn: "1111111111111", Title: "Book1", Categories: "自然科学"},
+			{Isbn: "2222222222222", Title: "Book2", Categories: "文学"},
+		},
+	}
+
+	testDetailFetcher := DetailFetcherStub{
+		details: map[string]*details.DetailedInformation{},
+	}
+	testNotifier := NotifierStub{}
+	testFavoriteFilter := FilterStub{
+		FavoriteCategories: []string{"自然科学"},
+	}
+
+	numProcessed := coreProcess(
+		&inputBookList,
+		&testDetailFetcher,
+		nil,
+		&testFavoriteFilter,
+		&testNotifier,
+		nil,
+		false,
+		2,
+	)
+
+	assert.Equal(t, 2, numProcessed.NewBooks)
+	assert.Equal(t, 1, len(testNotifier.Messages))
+}
+
+func TestCoreProcessCountsFailuresOfEachStage(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	dateUploaded := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	inputBookList := models.BookList{
+		UploadDate: dateUploaded,
+		Books: []*models.Book{
+			{Isbn: "1111111111111", Title: "Book1", Categories: "自然科学"},
+			{Isbn: "2222222222222", Title: "Book2", Categories: "文学"},
+			{Isbn: "3333333333333", Title: "Book3", Categories: "自然科学"},
+		},
+	}
+
+	testRecorder := RecorderStub{IsError: true}
+	testDetailFetcher := DetailFetcherStub{
+		details: map[string]*details.DetailedInformation{},
+	}
+	testNotifier := NotifierStub{IsError: true}
+	testFavoriteFilter := FilterStub{
+		FavoriteCategories: []string{"自然科学"},
+	}
+
+	result := coreProcess(
+		&inputBookList,
+		&testDetailFetcher,
+		&testRecorder,
+		&testFavoriteFilter,
+		&testNotifier,
+		nil,
+		false,
+		2,
+	)
+
+	assert.Equal(t, 3, result.NewBooks)
+	assert.Equal(t, StageResult{Succeeded: 0, Failed: 1}, result.Lookup)
+	assert.Equal(t, 3, result.EmptyDetails)
+	assert.Equal(t, StageResult{Succeeded: 0, Failed: 2}, result.Notification)
+	assert.Equal(t, StageResult{Succeeded: 0, Failed: 3}, result.Recording)
+	assert.Equal(t, exitRecordingFailed, result.ExitCode(0, 0))
+}
+
+type NotificationTrackerStub struct {
+	Deliveries map[string]*models.Delivery
+	Saved      []models.Delivery
+	mu         sync.Mutex
+}
+
+func (tr *NotificationTrackerStub) GetDeliveries(ctx context.Context) (map[string]*models.Delivery, error) {
+	return tr.Deliveries, nil
+}
+
+func (tr *NotificationTrackerStub) SaveDelivery(ctx context.Context, delivery *models.Delivery) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.Saved = append(tr.Saved, *delivery)
+	return nil
+}
+
+func TestCoreProcessNotifiesOnlyUndeliveredBooks(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	dateUploaded := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	inputBookList := models.BookList{
+		UploadDate: dateUploaded,
+		Books: []*models.Book{
+			{Isbn: "1111111111111", Title: "Sent before the recording failed", Categories: "自然科学"},
+			{Isbn: "2222222222222", Title: "Failed in the previous run", Categories: "自然科学"},
+			{Isbn: "3333333333333", Title: "Newly arrived book", Categories: "自然科学"},
+		},
+	}
+
+	testRecorder := RecorderStub{}
+	testDetailFetcher := DetailFetcherStub{
+		details: map[string]*details.DetailedInformation{},
+	}
+	testNotifier := NotifierStub{}
+	testFavoriteFilter := FilterStub{
+		FavoriteCategories: []string{"自然科学"},
+	}
+	testTracker := NotificationTrackerStub{
+		Deliveries: map[string]*models.Delivery{
+			"1111111111111": {ISBN: "1111111111111", Status: models.DeliverySent, Message: "book1"},
+			"2222222222222": {ISBN: "2222222222222", Status: models.DeliveryFailed, Message: "book2"},
+			"4444444444444": {ISBN: "4444444444444", Status: models.DeliveryPending, Message: "recorded book4"},
+			"5555555555555": {ISBN: "5555555555555", Status: models.DeliverySent, Message: "recorded book5"},
+		},
+	}
+
+	result := coreProcess(
+		&inputBookList,
+		&testDetailFetcher,
+		&testRecorder,
+		&testFavoriteFilter,
+		&testNotifier,
+		&testTracker,
+		false,
+		2,
+	)
+
+	assert.Equal(t, 3, len(testNotifier.Messages))
+	assert.Contains(t, testNotifier.Messages, "recorded book4")
+	assert.Equal(t, StageResult{Succeeded: 3, Failed: 0}, result.Notification)
+	assert.Equal(t, 1, result.AlreadyNotified)
+
+	var sentISBN []string
+	for _, delivery := range testTracker.Saved {
+		if delivery.Status == models.DeliverySent {
+			sentISBN = append(sentISBN, delivery.ISBN)
+		}
+	}
+	assert.ElementsMatch(t, []string{"2222222222222", "3333333333333", "4444444444444"}, sentISBN)
+	assert.Equal(t, 6, len(testTracker.Saved))
+}
+
+func TestCoreProcessTracksFailedNotification(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	dateUploaded := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	inputBookList := models.BookList{
+		UploadDate: dateUploaded,
+		Books: []*models.Book{
+			{Isbn: "1111111111111", Title: "Book1", Categories: "自然科学"},
+		},
+	}
+
+	testDetailFetcher := DetailFetcherStub{
+		details: map[string]*details.DetailedInformation{},
+	}
+	testNotifier := NotifierStub{IsError: true}
+	testFavoriteFilter := FilterStub{
+		FavoriteCategories: []string{"自然科学"},
+	}
+	testTracker := NotificationTrackerStub{}
+
+	coreProcess(
+		&inputBookList,
+		&testDetailFetcher,
+		nil,
+		&testFavoriteFilter,
+		&testNotifier,
+		&testTracker,
+		false,
+		2,
+	)
+
+	assert.Equal(t, 2, len(testTracker.Saved))
+	assert.Equal(t, models.DeliveryPending, testTracker.Saved[0].Status)
+	assert.Equal(t, models.DeliveryFailed, testTracker.Saved[1].Status)
+	assert.Equal(t, inputBookList.Books[0].AsNotificationMessage(), testTracker.Saved[1].Message)
+}
+
+type RecordedBookLookupStub struct {
+	RecorderStub
+	RecordedBooks map[string]*models.RecordedBook
+}
+
+func (r *RecordedBookLookupStub) GetRecordedBooks(ctx context.Context, targetDate time.Time) (map[string]*models.RecordedBook, error) {
+	return r.RecordedBooks, nil
+}
+
+func TestCoreProcessNotifiesUpdatedBooks(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	today := time.Date(2024, time.August, 2, 22, 42, 0, 0, loc)
+	yesterday := today.AddDate(0, 0, -1)
+	pubDate := time.Date(2024, time.September, 1, 0, 0, 0, 0, loc)
+	inputBookList := models.BookList{
+		UploadDate: today,
+		Books: []*models.Book{
+			{Isbn: "1111111111111", Title: "Postponed book", Categories: "自然科学", PubDate: pubDate.AddDate(0, 1, 0)},
+			{Isbn: "2222222222222", Title: "Unchanged book", Categories: "自然科学", PubDate: pubDate},
+			{Isbn: "3333333333333", Title: "Recorded today", Categories: "自然科学", PubDate: pubDate},
+			{Isbn: "4444444444444", Title: "Newly arrived book", Categories: "自然科学", PubDate: pubDate},
+		},
+	}
+
+	testRecorder := RecordedBookLookupStub{
+		RecordedBooks: map[string]*models.RecordedBook{
+			"1111111111111": {Isbn: "1111111111111", Title: "Postponed book", PubDate: pubDate, UploadedDate: yesterday},
+			"2222222222222": {Isbn: "2222222222222", Title: "Unchanged book", PubDate: pubDate, UploadedDate: yesterday},
+			"3333333333333": {Isbn: "3333333333333", Title: "Recorded today", PubDate: pubDate, UploadedDate: today},
+		},
+	}
+	testDetailFetcher := DetailFetcherStub{
+		details: map[string]*details.DetailedInformation{
+			"1111111111111": {PubDate: pubDate.AddDate(0, 1, 0)},
+			"2222222222222": {PubDate: pubDate},
+			"3333333333333": {PubDate: pubDate},
+			"4444444444444": {PubDate: pubDate},
+		},
+	}
+	testNotifier := NotifierStub{}
+	testFavoriteFilter := FilterStub{
+		FavoriteCategories: []string{"自然科学"},
+	}
+
+	result := coreProcess(
+		&inputBookList,
+		&testDetailFetcher,
+		&testRecorder,
+		&testFavoriteFilter,
+		&testNotifier,
+		nil,
+		true,
+		1,
+	)
+
+	assert.Equal(t, 1, result.NewBooks)
+	assert.Equal(t, 1, result.UpdatedBooks)
+	assert.Equal(t, []string{
+		"[情報更新] <|Postponed book>\n発売日: 2024/09/01 → 2024/10/01",
+		inputBookList.Books[3].AsNotificationMessage(),
+	}, testNotifier.Messages)
+	assert.ElementsMatch(t, []string{"1111111111111", "4444444444444"}, testRecorder.RecordedISBN)
+}
+
+func TestCoreProcessDoesNotNotifyUpdatesWithoutDetails(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	today := time.Date(2024, time.August, 2, 22, 42, 0, 0, loc)
+	yesterday := today.AddDate(0, 0, -1)
+	pubDate := time.Date(2024, time.September, 1, 0, 0, 0, 0, loc)
+
+	// The fetch fails, or OpenBD does not know the book and returns empty details.
+	for _, testDetailFetcher := range []*DetailFetcherStub{
+		{IsError: true},
+		{details: map[string]*details.DetailedInformation{}},
+	} {
+		inputBookList := models.BookList{
+			UploadDate: today,
+			Books: []*models.Book{
+				{Isbn: "1111111111111", Title: "Recorded book", Categories: "自然科学", PubDate: today},
+			},
+		}
+		testRecorder := RecordedBookLookupStub{
+			RecordedBooks: map[string]*models.RecordedBook{
+				"1111111111111": {Isbn: "1111111111111", Title: "Recorded book", PubDate: pubDate, UploadedDate: yesterday},
+			},
+		}
+		testNotifier := NotifierStub{}
+		testFavoriteFilter := FilterStub{
+			FavoriteCategories: []string{"自然科学"},
+		}
+
+		result := coreProcess(
+			&inputBookList,
+			testDetailFetcher,
+			&testRecorder,
+			&testFavoriteFilter,
+			&testNotifier,
+			nil,
+			true,
+			1,
+		)
+
+		assert.Equal(t, 0, result.UpdatedBooks)
+		assert.Empty(t, testNotifier.Messages)
+		assert.Empty(t, testRecorder.RecordedISBN)
+	}
+}
+
+func TestCoreProcessKeepsProcessedBooks(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	bookList := &models.BookList{UploadDate: date, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "Book1"},
+		{Isbn: "2222222222222", Title: "Book2"},
+	}}
+
+	result := coreProcess(
+		bookList, &DetailFetcherStub{}, &RecorderStub{RecordedISBN: []string{"1111111111111"}},
+		&FilterStub{}, &NotifierStub{}, nil, false, 1,
+	)
+
+	assert.Equal(t, 1, len(result.ProcessedBooks.Books))
+	assert.Equal(t, "2222222222222", result.ProcessedBooks.Books[0].Isbn)
+}
+
+// KeyedRecorderStub keeps one record per ISBN as the upserting recorders do,
+// updating only the date it was last seen when a book is recorded again.
+type KeyedRecorderStub struct {
+	UploadedDate map[string]string
+	LastSeenDate map[string]string
+}
+
+func (r *KeyedRecorderStub) GetRecordedISBN(ctx context.Context, targetDate time.Time) ([]string, error) {
+	var recordedISBN []string
+	for isbn, lastSeenDate := range r.LastSeenDate {
+		if lastSeenDate == targetDate.Format("2006-01-02") {
+			recordedISBN = append(recordedISBN, isbn)
+		}
+	}
+	return recordedISBN, nil
+}
+
+func (r *KeyedRecorderStub) SaveRecords(ctx context.Context, bookList *models.BookList) error {
+	for _, book := range bookList.Books {
+		if _, ok := r.UploadedDate[book.Isbn]; !ok {
+			r.UploadedDate[book.Isbn] = bookList.UploadDate.Format("2006-01-02")
+		}
+		r.LastSeenDate[book.Isbn] = bookList.UploadDate.Format("2006-01-02")
+	}
+	return nil
+}
+
+func TestCoreProcessDoesNotNotifyAgainOnRerunWithKeyedRecorder(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	day1 := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	day2 := day1.AddDate(0, 0, 1)
+	newBookList := func(uploadDate time.Time) *models.BookList {
+		return &models.BookList{UploadDate: uploadDate, Books: []*models.Book{
+			{Isbn: "1111111111111", Title: "Book1", Categories: "自然科学"},
+		}}
+	}
+	recorder := &KeyedRecorderStub{UploadedDate: map[string]string{}, LastSeenDate: map[string]string{}}
+	filter := &FilterStub{FavoriteCategories: []string{"自然科学"}}
+
+	notifier := &NotifierStub{}
+	coreProcess(newBookList(day1), &DetailFetcherStub{}, recorder, filter, notifier, nil, false, 1)
+	assert.Equal(t, 1, len(notifier.Messages))
+
+	// Listed again on the next day, the book is out of the dedup window of a day.
+	notifier = &NotifierStub{}
+	coreProcess(newBookList(day2), &DetailFetcherStub{}, recorder, filter, notifier, nil, false, 1)
+	assert.Equal(t, 1, len(notifier.Messages))
+
+	notifier = &NotifierStub{}
+	result := coreProcess(newBookList(day2), &DetailFetcherStub{}, recorder, filter, notifier, nil, false, 1)
+	assert.Equal(t, 0, len(notifier.Messages))
+	assert.Equal(t, 0, result.NewBooks)
+	assert.Equal(t, "2024-08-01", recorder.UploadedDate["1111111111111"])
 }
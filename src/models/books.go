@@ -19,6 +19,7 @@ type BookList struct {
 type Book struct {
 	Isbn            string
 	Title           string
+	Sources         []string
 	Url             string
 	Authors         string
 	Publisher       string
@@ -27,6 +28,19 @@ type Book struct {
 	Target          string
 	Format          string
 	Content         string
+	Ndc             string
+	NdcClass        string
+	NdcDivision     string
+	GenreCode       string
+	Price           int
+	Pages           int
+	Size            string
+	TableOfContents string
+	Description     string
+	Contributors    []Contributor
+	Series          string
+	Volume          string
+	CoverURL        string
 	PubDate         time.Time
 	CreatedDate     time.Time
 	LastUpdatedDate time.Time
@@ -62,6 +76,56 @@ func extractISBN(link string) string {
 	return re.FindString(u.Path)
 }
 
+// TagSource records the name of the feed source on every book of the list.
+func (bl *BookList) TagSource(name string) {
+	for _, book := range bl.Books {
+		book.Sources = []string{name}
+	}
+}
+
+// MergeBookLists merges the book lists of several feed sources into one.
+// A book found in several sources is kept once, with the sources of its duplicates added to Sources.
+// The latest upload date among the lists is used for the merged list.
+func MergeBookLists(bookLists ...*BookList) *BookList {
+
+	merged := BookList{Books: []*Book{}}
+	booksByISBN := make(map[string]*Book)
+	for _, bookList := range bookLists {
+		if bookList.UploadDate.After(merged.UploadDate) {
+			merged.UploadDate = bookList.UploadDate
+		}
+		for _, book := range bookList.Books {
+			if book.Isbn == "" {
+				merged.Books = append(merged.Books, book)
+				continue
+			}
+			if mergedBook, ok := booksByISBN[book.Isbn]; ok {
+				mergedBook.addSources(book.Sources)
+				continue
+			}
+			booksByISBN[book.Isbn] = book
+			merged.Books = append(merged.Books, book)
+		}
+	}
+
+	return &merged
+}
+
+func (b *Book) addSources(sources []string) {
+	for _, source := range sources {
+		found := false
+		for _, s := range b.Sources {
+			if s == source {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.Sources = append(b.Sources, source)
+		}
+	}
+}
+
 func (bl *BookList) FilterOut(isbns []string) *BookList {
 
 	m := make(map[string]bool)
@@ -90,6 +154,23 @@ func (b *Book) UpdateDetails(detailedInfo *details.DetailedInformation) {
 	b.Target = detailedInfo.Target
 	b.Format = detailedInfo.Format
 	b.Content = detailedInfo.Content
+	b.Ndc = detailedInfo.Ndc
+	b.NdcClass = detailedInfo.NdcClass
+	b.NdcDivision = detailedInfo.NdcDivision
+	b.GenreCode = detailedInfo.GenreCode
+
+	b.Price = detailedInfo.Price
+	b.Pages = detailedInfo.Pages
+	b.Size = detailedInfo.Size
+	b.TableOfContents = detailedInfo.TableOfContents
+	b.Description = detailedInfo.Description
+	b.Contributors = newContributors(detailedInfo.Contributors, detailedInfo.Author)
+	b.Series = detailedInfo.Series
+	b.Volume = detailedInfo.Volume
+	b.CoverURL = detailedInfo.CoverURL
+	if !detailedInfo.PubDate.IsZero() {
+		b.PubDate = detailedInfo.PubDate
+	}
 
 	b.CreatedDate = detailedInfo.CreatedDate
 	b.LastUpdatedDate = detailedInfo.LastUpdatedDate
@@ -102,6 +183,21 @@ func (b *Book) AsNotificationMessage() string {
 	categories := b.Categories
 	content := b.Content
 
-	message := fmt.Sprintf("<%s|%s>\n発売日: %s\nカテゴリー: %s\n内容: %s", url, title, pubDate, categories, content)
-	return message
+	lines := []string{fmt.Sprintf("<%s|%s>", url, title)}
+	if b.Authors != "" {
+		lines = append(lines, fmt.Sprintf("著者: %s", b.Authors))
+	}
+	lines = append(lines, fmt.Sprintf("発売日: %s", pubDate))
+	if b.Price > 0 {
+		lines = append(lines, fmt.Sprintf("価格: %d円", b.Price))
+	}
+	if b.Pages > 0 {
+		lines = append(lines, fmt.Sprintf("ページ数: %d", b.Pages))
+	}
+	lines = append(lines,
+		fmt.Sprintf("カテゴリー: %s", categories),
+		fmt.Sprintf("内容: %s", content),
+	)
+
+	return strings.Join(lines, "\n")
 }
@@ -100,6 +100,42 @@ func TestFilterOutBookListByISBNCorrectly(t *testing.T) {
 
 }
 
+func TestMergeBookListsDeduplicatesByISBN(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	earlier := time.Date(2024, time.September, 1, 22, 0, 0, 0, loc)
+	later := time.Date(2024, time.September, 1, 22, 42, 0, 0, loc)
+
+	publisherBookList := BookList{
+		UploadDate: earlier,
+		Books: []*Book{
+			{Isbn: "1111111111111", Title: "Book1"},
+			{Isbn: "2222222222222", Title: "Book2"},
+		},
+	}
+	publisherBookList.TagSource("publisher")
+	genreBookList := BookList{
+		UploadDate: later,
+		Books: []*Book{
+			{Isbn: "2222222222222", Title: "Book2"},
+			{Isbn: "3333333333333", Title: "Book3"},
+		},
+	}
+	genreBookList.TagSource("genre")
+
+	expectedBookList := BookList{
+		UploadDate: later,
+		Books: []*Book{
+			{Isbn: "1111111111111", Title: "Book1", Sources: []string{"publisher"}},
+			{Isbn: "2222222222222", Title: "Book2", Sources: []string{"publisher", "genre"}},
+			{Isbn: "3333333333333", Title: "Book3", Sources: []string{"genre"}},
+		},
+	}
+
+	actualBookList := MergeBookLists(&publisherBookList, &genreBookList)
+
+	assert.EqualValues(t, expectedBookList, *actualBookList)
+}
+
 func TestExtractISBN(t *testing.T) {
 	inputURL := "http://example.com/bd/isbn/9999999999999"
 	expectedISBN := "9999999999999"
@@ -134,16 +170,20 @@ func TestUpdateDetails(t *testing.T) {
 	}
 
 	expectedUpdatedBook := Book{
-		Isbn:            "1111111111111",
-		Title:           "ご冗談でしょう、tatamiyaさん - tatamiya tamiya(著 / 文) | 畳屋書店",
-		Url:             "http://example.com/bd/isbn/1111111111111",
-		Authors:         "tatamiya tamiya／著 畳の科学／編集",
-		Publisher:       "畳屋書店",
-		Categories:      "自然科学",
-		Ccode:           "1040",
-		Target:          "教養",
-		Format:          "単行本",
-		Content:         "自然科学総記",
+		Isbn:       "1111111111111",
+		Title:      "ご冗談でしょう、tatamiyaさん - tatamiya tamiya(著 / 文) | 畳屋書店",
+		Url:        "http://example.com/bd/isbn/1111111111111",
+		Authors:    "tatamiya tamiya／著 畳の科学／編集",
+		Publisher:  "畳屋書店",
+		Categories: "自然科学",
+		Ccode:      "1040",
+		Target:     "教養",
+		Format:     "単行本",
+		Content:    "自然科学総記",
+		Contributors: []Contributor{
+			{Name: "tatamiya tamiya", Role: RoleAuthor},
+			{Name: "畳の科学", Role: RoleEditor},
+		},
 		PubDate:         pubDate,
 		CreatedDate:     createdDate,
 		LastUpdatedDate: lastUpdatedDate,
@@ -179,3 +219,76 @@ func TestCreateNotificationMessageCorrectly(t *testing.T) {
 
 	assert.EqualValues(t, expectedMessage, actualMessage)
 }
+
+func TestUpdateDetailsWithRichMetadata(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+
+	feedPubDate := time.Date(2024, time.August, 31, 12, 13, 24, 0, loc)
+	sampleBook := Book{
+		Isbn:    "1111111111111",
+		PubDate: feedPubDate,
+	}
+
+	openBDPubDate := time.Date(2024, time.September, 2, 0, 0, 0, 0, loc)
+	inputDetailedInfo := details.DetailedInformation{
+		Ndc:             "913.6",
+		NdcClass:        "文学",
+		NdcDivision:     "日本文学",
+		GenreCode:       "01",
+		Price:           2400,
+		Pages:           256,
+		Size:            "188x128mm",
+		TableOfContents: "第1章 い草",
+		Description:     "畳にまつわる物理学の本",
+		Contributors: []details.ContributorDetail{
+			{Name: "tatamiya tamiya", Reading: "タタミヤ タミヤ", Roles: []string{"A01"}},
+		},
+		Series:   "シリーズ畳の不思議",
+		Volume:   "1",
+		CoverURL: "https://cover.openbd.jp/1111111111111.jpg",
+		PubDate:  openBDPubDate,
+	}
+
+	sampleBook.UpdateDetails(&inputDetailedInfo)
+
+	assert.Equal(t, "913.6", sampleBook.Ndc)
+	assert.Equal(t, "文学", sampleBook.NdcClass)
+	assert.Equal(t, "日本文学", sampleBook.NdcDivision)
+	assert.Equal(t, "01", sampleBook.GenreCode)
+	assert.Equal(t, 2400, sampleBook.Price)
+	assert.Equal(t, 256, sampleBook.Pages)
+	assert.Equal(t, "188x128mm", sampleBook.Size)
+	assert.Equal(t, "第1章 い草", sampleBook.TableOfContents)
+	assert.Equal(t, "畳にまつわる物理学の本", sampleBook.Description)
+	assert.EqualValues(t, []Contributor{{Name: "tatamiya tamiya", Reading: "タタミヤ タミヤ", Role: RoleAuthor}}, sampleBook.Contributors)
+	assert.Equal(t, "シリーズ畳の不思議", sampleBook.Series)
+	assert.Equal(t, "1", sampleBook.Volume)
+	assert.Equal(t, "https://cover.openbd.jp/1111111111111.jpg", sampleBook.CoverURL)
+	assert.Equal(t, openBDPubDate, sampleBook.PubDate)
+}
+
+func TestCreateNotificationMessageWithAuthorsAndPrice(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date1 := time.Date(2024, time.August, 31, 12, 13, 24, 0, loc)
+	sampleBook := Book{
+		Isbn:       "1111111111111",
+		Title:      "ご冗談でしょう、tatamiyaさん",
+		Url:        "http://example.com/bd/isbn/1111111111111",
+		Authors:    "tatamiya tamiya／著",
+		PubDate:    date1,
+		Price:      2400,
+		Pages:      256,
+		Categories: "自然科学",
+		Content:    "物理学",
+	}
+
+	expectedMessage := `<http://example.com/bd/isbn/1111111111111|ご冗談でしょう、tatamiyaさん>
+著者: tatamiya tamiya／著
+発売日: 2024/08/31
+価格: 2400円
+ページ数: 256
+カテゴリー: 自然科学
+内容: 物理学`
+
+	assert.EqualValues(t, expectedMessage, sampleBook.AsNotificationMessage())
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tatamiya/new-books-notification/src/details"
+)
+
+type ContributorRole string
+
+const (
+	RoleAuthor      ContributorRole = "author"
+	RoleTranslator  ContributorRole = "translator"
+	RoleEditor      ContributorRole = "editor"
+	RoleSupervisor  ContributorRole = "supervisor"
+	RoleIllustrator ContributorRole = "illustrator"
+	RoleOther       ContributorRole = "other"
+)
+
+// ContributorRoles lists the valid roles, e.g. for validating filter settings.
+var ContributorRoles = []ContributorRole{
+	RoleAuthor, RoleTranslator, RoleEditor, RoleSupervisor, RoleIllustrator, RoleOther,
+}
+
+type Contributor struct {
+	Name    string
+	Reading string
+	Role    ContributorRole
+}
+
+// ONIX contributor role codes used by JPRO, which OpenBD records are based on.
+var onixContributorRoles = map[string]ContributorRole{
+	"A01": RoleAuthor,
+	"A12": RoleIllustrator,
+	"B01": RoleEditor,
+	"B06": RoleTranslator,
+	"B20": RoleSupervisor,
+}
+
+// Role labels used in the author string of the summary, e.g. "山田太郎／著 鈴木花子／訳".
+var authorLabelRoles = map[string]ContributorRole{
+	"著":    RoleAuthor,
+	"文":    RoleAuthor,
+	"著/文":  RoleAuthor,
+	"作":    RoleAuthor,
+	"訳":    RoleTranslator,
+	"翻訳":   RoleTranslator,
+	"編":    RoleEditor,
+	"編集":   RoleEditor,
+	"編著":   RoleEditor,
+	"監修":   RoleSupervisor,
+	"絵":    RoleIllustrator,
+	"画":    RoleIllustrator,
+	"イラスト": RoleIllustrator,
+}
+
+var authorEntryPattern = regexp.MustCompile(`\s*([^／]+?)／(\S+)`)
+
+// newContributors builds the contributors from the ONIX Contributor entries.
+// When the record has none, the author string of the summary is parsed instead.
+func newContributors(contributorDetails []details.ContributorDetail, authors string) []Contributor {
+
+	if len(contributorDetails) == 0 {
+		return parseAuthors(authors)
+	}
+
+	var contributors []Contributor
+	for _, detail := range contributorDetails {
+		role := RoleOther
+		if len(detail.Roles) > 0 {
+			if r, ok := onixContributorRoles[detail.Roles[0]]; ok {
+				role = r
+			}
+		}
+		contributors = append(contributors, Contributor{
+			Name:    detail.Name,
+			Reading: detail.Reading,
+			Role:    role,
+		})
+	}
+	return contributors
+}
+
+func parseAuthors(authors string) []Contributor {
+
+	authors = strings.TrimSpace(authors)
+	if authors == "" {
+		return nil
+	}
+
+	matches := authorEntryPattern.FindAllStringSubmatch(authors, -1)
+	if len(matches) == 0 {
+		return []Contributor{{Name: authors, Role: RoleOther}}
+	}
+
+	var contributors []Contributor
+	for _, match := range matches {
+		role, ok := authorLabelRoles[match[2]]
+		if !ok {
+			role = RoleOther
+		}
+		contributors = append(contributors, Contributor{
+			Name: strings.TrimSpace(match[1]),
+			Role: role,
+		})
+	}
+	return contributors
+}
+
+// NormalizeName removes the spaces in a name so that "山田 太郎" and "山田太郎" are regarded as the same person.
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(name), "")
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/new-books-notification/src/details"
+)
+
+func TestNewContributorsFromONIXEntries(t *testing.T) {
+	inputDetails := []details.ContributorDetail{
+		{Name: "山田 太郎", Reading: "ヤマダ タロウ", Roles: []string{"A01"}},
+		{Name: "鈴木 花子", Reading: "スズキ ハナコ", Roles: []string{"B06"}},
+		{Name: "畳の科学", Roles: []string{"B20"}},
+		{Name: "装丁家", Roles: []string{"A36"}},
+	}
+
+	expectedContributors := []Contributor{
+		{Name: "山田 太郎", Reading: "ヤマダ タロウ", Role: RoleAuthor},
+		{Name: "鈴木 花子", Reading: "スズキ ハナコ", Role: RoleTranslator},
+		{Name: "畳の科学", Role: RoleSupervisor},
+		{Name: "装丁家", Role: RoleOther},
+	}
+
+	actualContributors := newContributors(inputDetails, "山田太郎／著 鈴木花子／訳")
+
+	assert.EqualValues(t, expectedContributors, actualContributors)
+}
+
+func TestNewContributorsFallsBackToAuthorString(t *testing.T) {
+	expectedContributors := []Contributor{
+		{Name: "山田太郎", Role: RoleAuthor},
+		{Name: "鈴木花子", Role: RoleTranslator},
+		{Name: "tatamiya tamiya", Role: RoleEditor},
+		{Name: "畳の科学", Role: RoleOther},
+	}
+
+	actualContributors := newContributors(nil, "山田太郎／著 鈴木花子／訳 tatamiya tamiya／編集 畳の科学／協力")
+
+	assert.EqualValues(t, expectedContributors, actualContributors)
+}
+
+func TestParseAuthorsWithoutRoles(t *testing.T) {
+	assert.EqualValues(t, []Contributor{{Name: "山田太郎", Role: RoleOther}}, parseAuthors("山田太郎"))
+	assert.Nil(t, parseAuthors(" "))
+}
+
+func TestNormalizeName(t *testing.T) {
+	assert.Equal(t, "山田太郎", NormalizeName("山田 太郎"))
+	assert.Equal(t, "山田太郎", NormalizeName("山田　太郎"))
+	assert.Equal(t, "tatamiyatamiya", NormalizeName(" tatamiya tamiya "))
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// DeliveryStatus is the state of the notification of a book to a channel.
+// A delivery is marked pending before it is posted, so that a run interrupted while posting
+// leaves it to be retried by the next run.
+type DeliveryStatus string
+
+const (
+	DeliveryPending DeliveryStatus = "pending"
+	DeliverySent    DeliveryStatus = "sent"
+	DeliveryFailed  DeliveryStatus = "failed"
+)
+
+// Delivery keeps the message so that a failed notification can be posted again by a later run,
+// even after the book itself has been recorded.
+type Delivery struct {
+	ISBN      string
+	Channel   string
+	Status    DeliveryStatus
+	Message   string
+	UpdatedAt time.Time
+}
+
+// LatestDeliveries picks the latest status of each ISBN from the history of the deliveries.
+// Of the rows saved at the same time, the result of the post wins over pending.
+func LatestDeliveries(history []*Delivery) map[string]*Delivery {
+
+	latest := make(map[string]*Delivery)
+	for _, d := range history {
+		current, ok := latest[d.ISBN]
+		if ok && (d.UpdatedAt.Before(current.UpdatedAt) ||
+			d.UpdatedAt.Equal(current.UpdatedAt) && d.Status == DeliveryPending) {
+			continue
+		}
+		latest[d.ISBN] = d
+	}
+	return latest
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatestDeliveriesPicksLatestStatusOfEachISBN(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	first := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	second := first.Add(time.Second)
+
+	history := []*Delivery{
+		{ISBN: "1111111111111", Status: DeliveryFailed, UpdatedAt: second},
+		{ISBN: "1111111111111", Status: DeliveryPending, UpdatedAt: first},
+		{ISBN: "2222222222222", Status: DeliveryPending, UpdatedAt: first},
+		{ISBN: "3333333333333", Status: DeliverySent, UpdatedAt: first},
+		{ISBN: "3333333333333", Status: DeliveryPending, UpdatedAt: first},
+	}
+
+	latest := LatestDeliveries(history)
+
+	assert.Equal(t, 3, len(latest))
+	assert.Equal(t, DeliveryFailed, latest["1111111111111"].Status)
+	assert.Equal(t, DeliveryPending, latest["2222222222222"].Status)
+	assert.Equal(t, DeliverySent, latest["3333333333333"].Status)
+}
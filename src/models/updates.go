@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RecordedBook is the latest record of a book, compared with the feed to detect updates of its metadata.
+// UploadedDate is the date it was last recorded.
+type RecordedBook struct {
+	Isbn         string
+	Title        string
+	Publisher    string
+	Price        int
+	PubDate      time.Time
+	UploadedDate time.Time
+}
+
+// FieldChange is a change of an important field, labeled as in the notification message.
+type FieldChange struct {
+	Label  string
+	Before string
+	After  string
+}
+
+// ChangedFields lists the important fields of the book which differ from the record.
+// Fields unknown in the book, e.g. not given by OpenBD, are not regarded as changed,
+// nor is a price unknown in the record, e.g. recorded before the price was.
+// The book is expected to have the details from OpenBD, since its publication date in the feed may differ from them.
+func (rb *RecordedBook) ChangedFields(b *Book) []FieldChange {
+
+	var changes []FieldChange
+	if title := strings.TrimSpace(b.Title); title != "" && title != strings.TrimSpace(rb.Title) {
+		changes = append(changes, FieldChange{Label: "タイトル", Before: strings.TrimSpace(rb.Title), After: title})
+	}
+	if before, after := rb.PubDate.Format("2006/01/02"), b.PubDate.Format("2006/01/02"); !b.PubDate.IsZero() && before != after {
+		changes = append(changes, FieldChange{Label: "発売日", Before: before, After: after})
+	}
+	if b.Publisher != "" && b.Publisher != rb.Publisher {
+		changes = append(changes, FieldChange{Label: "出版社", Before: rb.Publisher, After: b.Publisher})
+	}
+	if b.Price > 0 && rb.Price > 0 && b.Price != rb.Price {
+		changes = append(changes, FieldChange{Label: "価格", Before: fmt.Sprintf("%d円", rb.Price), After: fmt.Sprintf("%d円", b.Price)})
+	}
+	return changes
+}
+
+func (b *Book) AsUpdateNotificationMessage(changes []FieldChange) string {
+
+	lines := []string{fmt.Sprintf("[情報更新] <%s|%s>", b.Url, strings.TrimSpace(b.Title))}
+	for _, change := range changes {
+		lines = append(lines, fmt.Sprintf("%s: %s → %s", change.Label, change.Before, change.After))
+	}
+
+	return strings.Join(lines, "\n")
+}
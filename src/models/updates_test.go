@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangedFieldsOfRecordedBook(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	recordedPubDate := time.Date(2024, time.September, 1, 0, 0, 0, 0, loc)
+	recorded := RecordedBook{
+		Isbn:      "1111111111111",
+		Title:     "ご冗談でしょう、tatamiyaさん",
+		Publisher: "畳屋書店",
+		Price:     2400,
+		PubDate:   recordedPubDate,
+	}
+
+	unchanged := Book{
+		Isbn:    "1111111111111",
+		Title:   "ご冗談でしょう、tatamiyaさん\n",
+		PubDate: recordedPubDate.Add(12 * time.Hour),
+	}
+	assert.Empty(t, recorded.ChangedFields(&unchanged))
+
+	postponed := Book{
+		Isbn:      "1111111111111",
+		Title:     "ご冗談でしょう、tatamiyaさん",
+		Publisher: "畳屋書店",
+		Price:     2600,
+		PubDate:   time.Date(2024, time.October, 1, 0, 0, 0, 0, loc),
+	}
+	assert.Equal(t, []FieldChange{
+		{Label: "発売日", Before: "2024/09/01", After: "2024/10/01"},
+		{Label: "価格", Before: "2400円", After: "2600円"},
+	}, recorded.ChangedFields(&postponed))
+
+	recordedWithoutPrice := recorded
+	recordedWithoutPrice.Price = 0
+	postponed.PubDate = recordedPubDate
+	assert.Empty(t, recordedWithoutPrice.ChangedFields(&postponed))
+}
+
+func TestCreateUpdateNotificationMessageCorrectly(t *testing.T) {
+	book := Book{
+		Isbn:  "1111111111111",
+		Title: "ご冗談でしょう、tatamiyaさん",
+		Url:   "http://example.com/bd/isbn/1111111111111",
+	}
+	changes := []FieldChange{{Label: "発売日", Before: "2024/09/01", After: "2024/10/01"}}
+
+	expected := "[情報更新] <http://example.com/bd/isbn/1111111111111|ご冗談でしょう、tatamiyaさん>\n発売日: 2024/09/01 → 2024/10/01"
+	assert.Equal(t, expected, book.AsUpdateNotificationMessage(changes))
+}
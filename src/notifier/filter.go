@@ -30,9 +30,29 @@ func (cf *NotificationFilter) IsFavorite(book *models.Book) bool {
 }
 
 type conditionBlock struct {
+	comment    string
 	conditions []condition
 }
 
+// MatchedBlocks describes the condition blocks the book matches,
+// by their "_comment" in the filter settings or by their position.
+func (cf *NotificationFilter) MatchedBlocks(book *models.Book) []string {
+	var matched []string
+	for i, conditionBlock := range cf.conditionBlocks {
+		if conditionBlock.matchAny(book) {
+			matched = append(matched, conditionBlock.describe(i))
+		}
+	}
+	return matched
+}
+
+func (cb *conditionBlock) describe(index int) string {
+	if cb.comment != "" {
+		return cb.comment
+	}
+	return fmt.Sprintf("block %d", index+1)
+}
+
 type condition interface {
 	match(*models.Book) bool
 }
@@ -50,20 +70,23 @@ func (cb *conditionBlock) matchAny(book *models.Book) bool {
 
 type containCondition struct {
 	filterBy string
+	role     models.ContributorRole
 	words    []string
 }
 
 func (c *containCondition) match(book *models.Book) bool {
 	defaultResult := false
 
-	targetFieldValue, ok := getFieldValue(book, c.filterBy)
+	targetFieldValues, ok := getFieldValues(book, c.filterBy, c.role)
 	if !ok {
 		return defaultResult
 	}
 
-	for _, favWord := range c.words {
-		if targetFieldValue == favWord {
-			return true
+	for _, targetFieldValue := range targetFieldValues {
+		for _, favWord := range c.words {
+			if targetFieldValue == favWord {
+				return true
+			}
 		}
 	}
 
@@ -72,20 +95,48 @@ func (c *containCondition) match(book *models.Book) bool {
 
 type notContainCondition struct {
 	filterBy string
+	role     models.ContributorRole
 	words    []string
 }
 
 func (c *notContainCondition) match(book *models.Book) bool {
 	defaultResult := true
 
-	targetFieldValue, ok := getFieldValue(book, c.filterBy)
+	targetFieldValues, ok := getFieldValues(book, c.filterBy, c.role)
 	if !ok {
 		return defaultResult
 	}
 
-	for _, unfavWord := range c.words {
-		if targetFieldValue == unfavWord {
-			return false
+	for _, targetFieldValue := range targetFieldValues {
+		for _, unfavWord := range c.words {
+			if targetFieldValue == unfavWord {
+				return false
+			}
+		}
+	}
+
+	return defaultResult
+}
+
+type startWithCondition struct {
+	filterBy string
+	role     models.ContributorRole
+	words    []string
+}
+
+func (c *startWithCondition) match(book *models.Book) bool {
+	defaultResult := false
+
+	targetFieldValues, ok := getFieldValues(book, c.filterBy, c.role)
+	if !ok {
+		return defaultResult
+	}
+
+	for _, targetFieldValue := range targetFieldValues {
+		for _, favWord := range c.words {
+			if strings.HasPrefix(targetFieldValue, favWord) {
+				return true
+			}
 		}
 	}
 
@@ -94,33 +145,50 @@ func (c *notContainCondition) match(book *models.Book) bool {
 
 type notStartWithCondition struct {
 	filterBy string
+	role     models.ContributorRole
 	words    []string
 }
 
 func (c *notStartWithCondition) match(book *models.Book) bool {
 	defaultResult := true
 
-	targetFieldValue, ok := getFieldValue(book, c.filterBy)
+	targetFieldValues, ok := getFieldValues(book, c.filterBy, c.role)
 	if !ok {
 		return defaultResult
 	}
 
-	for _, unfavWord := range c.words {
-		if strings.HasPrefix(targetFieldValue, unfavWord) {
-			return false
+	for _, targetFieldValue := range targetFieldValues {
+		for _, unfavWord := range c.words {
+			if strings.HasPrefix(targetFieldValue, unfavWord) {
+				return false
+			}
 		}
 	}
 
 	return defaultResult
 }
 
-func getFieldValue(book *models.Book, fieldName string) (string, bool) {
+// getFieldValues returns the values of the field to be compared with the filter words.
+// For Contributors, these are the normalized names of the contributors with the given role,
+// or of all the contributors if role is empty.
+func getFieldValues(book *models.Book, fieldName string, role models.ContributorRole) ([]string, bool) {
 	bookValue := reflect.ValueOf(*book)
 	targetFieldValue := bookValue.FieldByName(fieldName)
 	if !targetFieldValue.IsValid() {
-		return "", false
+		return nil, false
+	}
+
+	if contributors, ok := targetFieldValue.Interface().([]models.Contributor); ok {
+		var names []string
+		for _, contributor := range contributors {
+			if role == "" || contributor.Role == role {
+				names = append(names, models.NormalizeName(contributor.Name))
+			}
+		}
+		return names, true
 	}
-	return targetFieldValue.String(), true
+
+	return []string{fmt.Sprint(targetFieldValue.Interface())}, true
 }
 
 type filterSettings struct {
@@ -128,16 +196,44 @@ type filterSettings struct {
 }
 
 type filterBlocks struct {
+	Comment    string            `json:"_comment"`
 	Conditions []filterCondition `json:"conditions"`
 }
 type filterCondition struct {
 	FilterBy   string   `json:"filter_by"`
 	FilterType string   `json:"type"`
+	Role       string   `json:"role"`
 	Words      []string `json:"words"`
 }
 
 func NewNotificationFilter(filterPath string) (*NotificationFilter, error) {
 
+	settings, err := readFilterSettings(filterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildNotificationFilter(settings), nil
+}
+
+// CheckNotificationFilter lists the problems of the filter settings, such as invalid field names,
+// which NewNotificationFilter only logs and skips.
+func CheckNotificationFilter(filterPath string) ([]string, error) {
+
+	settings, err := readFilterSettings(filterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, problems := compileNotificationFilter(settings)
+	if len(filter.conditionBlocks) == 0 {
+		problems = append(problems, "No valid condition block: nothing will be notified")
+	}
+	return problems, nil
+}
+
+func readFilterSettings(filterPath string) (*filterSettings, error) {
+
 	var settings filterSettings
 	filterData, ioErr := ioutil.ReadFile(filterPath)
 	if ioErr != nil {
@@ -148,16 +244,39 @@ func NewNotificationFilter(filterPath string) (*NotificationFilter, error) {
 		return nil, fmt.Errorf("could not unmarshal json data!: %s", jsonErr)
 	}
 
-	return buildNotificationFilter(&settings), nil
+	return &settings, nil
 }
 
 func buildNotificationFilter(settings *filterSettings) *NotificationFilter {
+	filter, problems := compileNotificationFilter(settings)
+	for _, problem := range problems {
+		log.Println(problem)
+	}
+	return filter
+}
+
+// compileNotificationFilter builds the filter, skipping the invalid conditions and reporting them as problems.
+func compileNotificationFilter(settings *filterSettings) (*NotificationFilter, []string) {
 	var blocks []*conditionBlock
+	var problems []string
 	for _, filterBlock := range settings.Blocks {
 		var conditions []condition
 		for _, filterCondition := range filterBlock.Conditions {
 			filterBy := strings.Title(filterCondition.FilterBy)
 			if !isValidFieldName(filterBy) {
+				problems = append(problems, fmt.Sprintf("Invalid field name: %s", filterCondition.FilterBy))
+				continue
+			}
+			role := models.ContributorRole(filterCondition.Role)
+			words := filterCondition.Words
+			if filterBy == contributorsFieldName {
+				if role != "" && !isValidRole(role) {
+					problems = append(problems, fmt.Sprintf("Invalid contributor role: %s", role))
+					continue
+				}
+				words = normalizeNames(words)
+			} else if role != "" {
+				problems = append(problems, fmt.Sprintf("Role is only available for %s: %s", contributorsFieldName, filterBy))
 				continue
 			}
 			var tempCondition condition
@@ -165,20 +284,29 @@ func buildNotificationFilter(settings *filterSettings) *NotificationFilter {
 			case "contain":
 				tempCondition = &containCondition{
 					filterBy: filterBy,
-					words:    filterCondition.Words,
+					role:     role,
+					words:    words,
 				}
 			case "not_contain":
 				tempCondition = &notContainCondition{
 					filterBy: filterBy,
-					words:    filterCondition.Words,
+					role:     role,
+					words:    words,
+				}
+			case "start_with":
+				tempCondition = &startWithCondition{
+					filterBy: filterBy,
+					role:     role,
+					words:    words,
 				}
 			case "not_start_with":
 				tempCondition = &notStartWithCondition{
 					filterBy: filterBy,
-					words:    filterCondition.Words,
+					role:     role,
+					words:    words,
 				}
 			default:
-				log.Printf("Invalid filter type: %s", filterCondition.FilterType)
+				problems = append(problems, fmt.Sprintf("Invalid filter type: %s", filterCondition.FilterType))
 			}
 
 			if tempCondition != nil {
@@ -186,16 +314,35 @@ func buildNotificationFilter(settings *filterSettings) *NotificationFilter {
 			}
 		}
 		if len(conditions) > 0 {
-			blocks = append(blocks, &conditionBlock{conditions: conditions})
+			blocks = append(blocks, &conditionBlock{comment: filterBlock.Comment, conditions: conditions})
 		}
 	}
 
 	return &NotificationFilter{
 		conditionBlocks: blocks,
-	}
+	}, problems
 }
 
 func isValidFieldName(fieldName string) bool {
 	bookValue := reflect.ValueOf(models.Book{})
 	return bookValue.FieldByName(fieldName).IsValid()
 }
+
+const contributorsFieldName = "Contributors"
+
+func isValidRole(role models.ContributorRole) bool {
+	for _, validRole := range models.ContributorRoles {
+		if role == validRole {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeNames(names []string) []string {
+	var normalized []string
+	for _, name := range names {
+		normalized = append(normalized, models.NormalizeName(name))
+	}
+	return normalized
+}
@@ -1,6 +1,8 @@
 package notifier
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,12 +15,14 @@ func TestLoadNewNotificationFilterSuccessfuly(t *testing.T) {
 	expectedNotificationFilter := NotificationFilter{
 		conditionBlocks: []*conditionBlock{
 			{
+				comment: "カテゴリが自然科学、もしくは内容が数学・物理学",
 				conditions: []condition{
 					&containCondition{filterBy: "Categories", words: []string{"自然科学"}},
 					&containCondition{filterBy: "Content", words: []string{"数学", "物理学"}},
 				},
 			},
 			{
+				comment: "学参は除外",
 				conditions: []condition{
 					&notContainCondition{filterBy: "Categories", words: []string{"学参"}},
 				},
@@ -286,3 +290,156 @@ func TestFilterReturnsFalseForEmptyCategoryAndContent(t *testing.T) {
 	}
 	assert.Equal(t, false, sampleFilter.IsFavorite(&bookWithEmptyCategory))
 }
+
+func TestContainConditionMatchesContributorsByRole(t *testing.T) {
+	testBook := models.Book{
+		Contributors: []models.Contributor{
+			{Name: "山田 太郎", Role: models.RoleAuthor},
+			{Name: "鈴木 花子", Role: models.RoleTranslator},
+		},
+	}
+
+	anyRoleCondition := containCondition{
+		filterBy: "Contributors",
+		words:    []string{"鈴木花子"},
+	}
+	assert.Equal(t, true, anyRoleCondition.match(&testBook))
+
+	translatorCondition := containCondition{
+		filterBy: "Contributors",
+		role:     models.RoleTranslator,
+		words:    []string{"鈴木花子"},
+	}
+	assert.Equal(t, true, translatorCondition.match(&testBook))
+
+	authorCondition := containCondition{
+		filterBy: "Contributors",
+		role:     models.RoleAuthor,
+		words:    []string{"鈴木花子"},
+	}
+	assert.Equal(t, false, authorCondition.match(&testBook))
+
+	assert.Equal(t, false, anyRoleCondition.match(&models.Book{}))
+}
+
+func TestNotContainConditionExcludesContributors(t *testing.T) {
+	testCondition := notContainCondition{
+		filterBy: "Contributors",
+		words:    []string{"山田太郎"},
+	}
+
+	bookWithUnfavoriteAuthor := models.Book{
+		Contributors: []models.Contributor{
+			{Name: "鈴木 花子", Role: models.RoleTranslator},
+			{Name: "山田 太郎", Role: models.RoleAuthor},
+		},
+	}
+	assert.Equal(t, false, testCondition.match(&bookWithUnfavoriteAuthor))
+	assert.Equal(t, true, testCondition.match(&models.Book{}))
+}
+
+func TestBuildNotificationFilterWithContributorConditions(t *testing.T) {
+	inputFilterSettings := filterSettings{
+		Blocks: []filterBlocks{
+			{
+				Conditions: []filterCondition{
+					{
+						FilterBy:   "contributors",
+						FilterType: "contain",
+						Role:       "translator",
+						Words:      []string{"鈴木 花子"},
+					},
+					{
+						FilterBy:   "contributors",
+						FilterType: "contain",
+						Role:       "INVALID",
+						Words:      []string{"hogehoge"},
+					},
+					{
+						FilterBy:   "categories",
+						FilterType: "contain",
+						Role:       "author",
+						Words:      []string{"hogehoge"},
+					},
+				},
+			},
+		},
+	}
+
+	expectedNotificationFilter := NotificationFilter{
+		conditionBlocks: []*conditionBlock{
+			{
+				conditions: []condition{
+					&containCondition{filterBy: "Contributors", role: models.RoleTranslator, words: []string{"鈴木花子"}},
+				},
+			},
+		},
+	}
+
+	actualNotificationFilter := buildNotificationFilter(&inputFilterSettings)
+
+	assert.EqualValues(t, expectedNotificationFilter, *actualNotificationFilter)
+}
+
+func TestStartWithConditionFiltersNDCHierarchy(t *testing.T) {
+	// Filter by NDC division 41 (数学) and 42 (物理学)
+	testCondition := startWithCondition{
+		filterBy: "Ndc",
+		words:    []string{"41", "42"},
+	}
+
+	bookWithFavoriteNDC := models.Book{
+		Ndc: "421.3",
+	}
+	assert.Equal(t, true, testCondition.match(&bookWithFavoriteNDC))
+
+	bookWithUnfavoriteNDC := models.Book{
+		Ndc: "913.6",
+	}
+	assert.Equal(t, false, testCondition.match(&bookWithUnfavoriteNDC))
+}
+
+func TestMatchedBlocksDescribesBlocksByCommentOrPosition(t *testing.T) {
+	testFilter := NotificationFilter{
+		conditionBlocks: []*conditionBlock{
+			{
+				comment:    "自然科学",
+				conditions: []condition{&containCondition{filterBy: "Categories", words: []string{"自然科学"}}},
+			},
+			{
+				conditions: []condition{&notContainCondition{filterBy: "Categories", words: []string{"学参"}}},
+			},
+			{
+				conditions: []condition{&containCondition{filterBy: "Content", words: []string{"数学"}}},
+			},
+		},
+	}
+	inputBook := models.Book{Categories: "自然科学", Content: "物理学"}
+
+	assert.EqualValues(t, []string{"自然科学", "block 2"}, testFilter.MatchedBlocks(&inputBook))
+}
+
+func TestCheckNotificationFilterReportsInvalidConditions(t *testing.T) {
+	filterPath := filepath.Join(t.TempDir(), "filter.json")
+	filterSettings := `{
+	"blocks": [
+		{
+			"conditions": [
+				{"filter_by": "categories", "type": "contain", "words": ["自然科学"]},
+				{"filter_by": "INVALID", "type": "contain", "words": ["数学"]},
+				{"filter_by": "content", "type": "INVALID", "words": ["数学"]}
+			]
+		}
+	]
+}`
+	assert.Nil(t, ioutil.WriteFile(filterPath, []byte(filterSettings), 0644))
+
+	problems, err := CheckNotificationFilter(filterPath)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"Invalid field name: INVALID", "Invalid filter type: INVALID"}, problems)
+
+	validProblems, err := CheckNotificationFilter("./test_notification_filter.json")
+	assert.Nil(t, err)
+	assert.Empty(t, validProblems)
+}
@@ -1,12 +1,24 @@
 package notifier
 
-import "github.com/slack-go/slack"
+import (
+	"context"
+	"fmt"
+
+	"github.com/slack-go/slack"
+	"golang.org/x/time/rate"
+)
 
 type SlackNotifier struct {
 	webhookURL string
+	limiter    *rate.Limiter
 }
 
 func (s *SlackNotifier) Post(message string) error {
+	if s.limiter != nil {
+		if err := s.limiter.Wait(context.Background()); err != nil {
+			return err
+		}
+	}
 	msg := slack.WebhookMessage{
 		Text: message,
 	}
@@ -14,9 +26,21 @@ func (s *SlackNotifier) Post(message string) error {
 	return err
 }
 
-func NewSlackNotifier(webhookURL string) (*SlackNotifier, error) {
+// NewSlackNotifier creates a notifier posting to the incoming webhook.
+// Posts are throttled to requestsPerSecond; zero or a negative value disables the limit.
+func NewSlackNotifier(webhookURL string, requestsPerSecond float64) (*SlackNotifier, error) {
+
+	if webhookURL == "" {
+		return nil, fmt.Errorf("Slack webhook URL is not set")
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if requestsPerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), 1)
+	}
 
 	return &SlackNotifier{
 		webhookURL: webhookURL,
+		limiter:    limiter,
 	}, nil
 }
@@ -0,0 +1,58 @@
+package notifier
+
+import "github.com/tatamiya/new-books-notification/src/models"
+
+// SourceFilter applies the filter of each feed source the book came from.
+// Books from sources without their own filter are judged by the default filter.
+// A book found in several sources is a favorite if any of the applied filters accepts it.
+type SourceFilter struct {
+	defaultFilter *NotificationFilter
+	sourceFilters map[string]*NotificationFilter
+}
+
+func NewSourceFilter(defaultFilter *NotificationFilter, sourceFilters map[string]*NotificationFilter) *SourceFilter {
+	return &SourceFilter{
+		defaultFilter: defaultFilter,
+		sourceFilters: sourceFilters,
+	}
+}
+
+func (sf *SourceFilter) IsFavorite(book *models.Book) bool {
+
+	useDefault := len(book.Sources) == 0
+	for _, source := range book.Sources {
+		filter, ok := sf.sourceFilters[source]
+		if !ok {
+			useDefault = true
+			continue
+		}
+		if filter.IsFavorite(book) {
+			return true
+		}
+	}
+
+	return useDefault && sf.defaultFilter != nil && sf.defaultFilter.IsFavorite(book)
+}
+
+// MatchedBlocks describes the condition blocks the book matches in the filters applied to it.
+// Blocks of a source filter are prefixed with the name of the source.
+func (sf *SourceFilter) MatchedBlocks(book *models.Book) []string {
+
+	var matched []string
+	useDefault := len(book.Sources) == 0
+	for _, source := range book.Sources {
+		filter, ok := sf.sourceFilters[source]
+		if !ok {
+			useDefault = true
+			continue
+		}
+		for _, block := range filter.MatchedBlocks(book) {
+			matched = append(matched, source+": "+block)
+		}
+	}
+	if useDefault && sf.defaultFilter != nil {
+		matched = append(matched, sf.defaultFilter.MatchedBlocks(book)...)
+	}
+
+	return matched
+}
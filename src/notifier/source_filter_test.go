@@ -0,0 +1,55 @@
+package notifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/new-books-notification/src/models"
+)
+
+func TestSourceFilterAppliesFilterOfEachSource(t *testing.T) {
+	defaultFilter := NotificationFilter{
+		conditionBlocks: []*conditionBlock{
+			{conditions: []condition{&containCondition{filterBy: "Categories", words: []string{"自然科学"}}}},
+		},
+	}
+	publisherFilter := NotificationFilter{
+		conditionBlocks: []*conditionBlock{
+			{conditions: []condition{&containCondition{filterBy: "Categories", words: []string{"文学"}}}},
+		},
+	}
+	sourceFilter := NewSourceFilter(&defaultFilter, map[string]*NotificationFilter{"publisher": &publisherFilter})
+
+	for _, testCase := range []struct {
+		sources    []string
+		categories string
+		expected   bool
+	}{
+		{sources: []string{"publisher"}, categories: "文学", expected: true},
+		{sources: []string{"publisher"}, categories: "自然科学", expected: false},
+		{sources: []string{"genre"}, categories: "自然科学", expected: true},
+		{sources: []string{"genre"}, categories: "文学", expected: false},
+		{sources: []string{"publisher", "genre"}, categories: "自然科学", expected: true},
+		{sources: nil, categories: "自然科学", expected: true},
+	} {
+		inputBook := models.Book{Sources: testCase.sources, Categories: testCase.categories}
+		assert.Equal(t, testCase.expected, sourceFilter.IsFavorite(&inputBook), "%v %s", testCase.sources, testCase.categories)
+	}
+}
+
+func TestSourceFilterDescribesMatchedBlocksOfEachSource(t *testing.T) {
+	defaultFilter := NotificationFilter{
+		conditionBlocks: []*conditionBlock{
+			{comment: "自然科学", conditions: []condition{&containCondition{filterBy: "Categories", words: []string{"自然科学"}}}},
+		},
+	}
+	publisherFilter := NotificationFilter{
+		conditionBlocks: []*conditionBlock{
+			{comment: "数学", conditions: []condition{&containCondition{filterBy: "Content", words: []string{"数学"}}}},
+		},
+	}
+	sourceFilter := NewSourceFilter(&defaultFilter, map[string]*NotificationFilter{"publisher": &publisherFilter})
+	inputBook := models.Book{Sources: []string{"publisher", "genre"}, Categories: "自然科学", Content: "数学"}
+
+	assert.EqualValues(t, []string{"publisher: 数学", "自然科学"}, sourceFilter.MatchedBlocks(&inputBook))
+}
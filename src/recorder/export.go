@@ -0,0 +1,63 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tatamiya/new-books-notification/src/models"
+)
+
+// EncodeCSV writes the records as CSV with a header of the column names of the table.
+// Sources are joined by ";" and Contributors are written as JSON, and empty cells are null.
+func EncodeCSV(bookList *models.BookList) ([]byte, error) {
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	var header []string
+	for _, field := range bqSchema {
+		header = append(header, field.Name)
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, book := range bookList.Books {
+		r := convertIntoRecord(book, bookList.UploadDate)
+		contributors, err := json.Marshal(r.Contributors)
+		if err != nil {
+			return nil, err
+		}
+		row := []string{
+			r.ISBN, r.PubDate.String(), r.Title, r.Url, strings.Join(r.Sources, ";"), r.Authors, string(contributors), r.Publisher, r.Categories, r.Ccode,
+			r.Target, r.Format, r.Content, r.Ndc, r.NdcClass, r.NdcDivision, r.GenreCode,
+			formatCSVInt(r.Price.Int64, r.Price.Valid), formatCSVInt(r.Pages.Int64, r.Pages.Valid), r.Size,
+			r.TableOfContents, r.Description, r.Series, r.Volume, r.CoverUrl,
+			formatCSVTime(r.CreatedAt), formatCSVTime(r.LastUpdatedAt), formatCSVTime(r.UploadedAt), r.UploadedDate.String(), r.LastSeenDate.String(),
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func formatCSVInt(n int64, valid bool) string {
+	if !valid {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func formatCSVTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
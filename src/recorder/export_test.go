@@ -0,0 +1,55 @@
+package recorder
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/new-books-notification/src/models"
+)
+
+func TestEncodeRecordsAsCSV(t *testing.T) {
+
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	pubDate := time.Date(2024, time.September, 1, 0, 0, 0, 0, loc)
+	uploadedDate := time.Date(2024, time.August, 1, 12, 30, 0, 0, loc)
+	bookList := models.BookList{UploadDate: uploadedDate, Books: []*models.Book{
+		{
+			Isbn: "1111111111111", Title: "ご冗談でしょう、tatamiyaさん", PubDate: pubDate, Price: 2400,
+			Sources:      []string{"hanmoto", "genre"},
+			Contributors: []models.Contributor{{Name: "tatamiya tamiya", Role: models.RoleAuthor}},
+		},
+		{Isbn: "2222222222222", Title: "流体力学, 後編", PubDate: pubDate},
+	}}
+
+	data, err := EncodeCSV(&bookList)
+	assert.Nil(t, err)
+
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(rows))
+	header := rows[0]
+	assert.Equal(t, len(bqSchema), len(header))
+	column := func(row []string, name string) string {
+		for i, columnName := range header {
+			if columnName == name {
+				return row[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+
+	assert.Equal(t, "1111111111111", column(rows[1], "ISBN"))
+	assert.Equal(t, "2024-09-01", column(rows[1], "PubDate"))
+	assert.Equal(t, "hanmoto;genre", column(rows[1], "Sources"))
+	assert.Contains(t, column(rows[1], "Contributors"), `"Name":"tatamiya tamiya"`)
+	assert.Equal(t, "2400", column(rows[1], "Price"))
+	assert.Equal(t, "2024-08-01T12:30:00+09:00", column(rows[1], "UploadedAt"))
+	assert.Equal(t, "2024-08-01", column(rows[1], "UploadedDate"))
+	assert.Equal(t, "流体力学, 後編", column(rows[2], "Title"))
+	assert.Equal(t, "", column(rows[2], "Price"))
+	assert.Equal(t, "", column(rows[2], "CreatedAt"))
+}
@@ -0,0 +1,131 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// schemaMigration is the plan to reconcile the schema of a live table with the desired one.
+type schemaMigration struct {
+	schema  bigquery.Schema
+	changes []string
+	// problems are the incompatible changes, which need a manual migration.
+	problems []string
+}
+
+// planSchemaMigration adds the nullable or repeated columns missing in the live schema,
+// including those of nested records and new records without required fields, and relaxes the required columns which are nullable in the desired one.
+// Columns only in the live schema are kept as they are.
+func planSchemaMigration(live bigquery.Schema, desired bigquery.Schema) *schemaMigration {
+	migration := &schemaMigration{}
+	migration.schema = migration.merge(live, desired, "")
+	return migration
+}
+
+func (m *schemaMigration) merge(live bigquery.Schema, desired bigquery.Schema, prefix string) bigquery.Schema {
+
+	liveFields := make(map[string]*bigquery.FieldSchema)
+	for _, field := range live {
+		liveFields[strings.ToLower(field.Name)] = field
+	}
+
+	var merged bigquery.Schema
+	for _, field := range live {
+		copied := *field
+		merged = append(merged, &copied)
+	}
+	for _, want := range desired {
+		name := prefix + want.Name
+		have, ok := liveFields[strings.ToLower(want.Name)]
+		if !ok {
+			if !m.addable(want, name) {
+				continue
+			}
+			merged = append(merged, want)
+			m.changes = append(m.changes, fmt.Sprintf("add column %s %s", name, want.Type))
+			continue
+		}
+
+		field := merged[indexOfField(merged, have.Name)]
+		if have.Type != want.Type {
+			m.problems = append(m.problems, fmt.Sprintf("column %s: type %s cannot be changed to %s", name, have.Type, want.Type))
+			continue
+		}
+		if have.Repeated != want.Repeated {
+			m.problems = append(m.problems, fmt.Sprintf("column %s: mode %s cannot be changed to %s", name, fieldMode(have), fieldMode(want)))
+			continue
+		}
+		if !have.Required && want.Required {
+			m.problems = append(m.problems, fmt.Sprintf("column %s: nullable column cannot be made required", name))
+			continue
+		}
+		if have.Required && !want.Required {
+			field.Required = false
+			m.changes = append(m.changes, fmt.Sprintf("relax column %s to NULLABLE", name))
+		}
+		if want.Type == bigquery.RecordFieldType {
+			field.Schema = m.merge(have.Schema, want.Schema, name+".")
+		}
+	}
+	return merged
+}
+
+// addable reports the required columns, if any, in the new column or its nested records,
+// which cannot be added to the existing rows.
+func (m *schemaMigration) addable(field *bigquery.FieldSchema, name string) bool {
+	if field.Required {
+		m.problems = append(m.problems, fmt.Sprintf("column %s: cannot add a required column to the existing rows", name))
+		return false
+	}
+	ok := true
+	for _, nested := range field.Schema {
+		if !m.addable(nested, name+"."+nested.Name) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+func indexOfField(schema bigquery.Schema, name string) int {
+	for i, field := range schema {
+		if field.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func fieldMode(field *bigquery.FieldSchema) string {
+	switch {
+	case field.Repeated:
+		return "REPEATED"
+	case field.Required:
+		return "REQUIRED"
+	default:
+		return "NULLABLE"
+	}
+}
+
+// migrateSchema reconciles the schema of the existing table with the desired one.
+// Nothing is changed when any incompatible change is found, and they are reported in the error.
+func migrateSchema(ctx context.Context, table *bigquery.Table, metadata *bigquery.TableMetadata, desired bigquery.Schema) error {
+
+	migration := planSchemaMigration(metadata.Schema, desired)
+	if len(migration.problems) > 0 {
+		return fmt.Errorf("schema of the table %s is incompatible:\n  %s", table.TableID, strings.Join(migration.problems, "\n  "))
+	}
+	if len(migration.changes) == 0 {
+		return nil
+	}
+
+	update := bigquery.TableMetadataToUpdate{Schema: migration.schema}
+	if _, err := table.Update(ctx, update, metadata.ETag); err != nil {
+		return fmt.Errorf("cannot migrate the schema of the table %s: %s", table.TableID, err)
+	}
+	log.Printf("Migrated the schema of the table %s:\n  %s", table.TableID, strings.Join(migration.changes, "\n  "))
+	return nil
+}
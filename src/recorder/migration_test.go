@@ -0,0 +1,106 @@
+package recorder
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanSchemaMigrationAddsNullableColumns(t *testing.T) {
+	live := bigquery.Schema{
+		{Name: "ISBN", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Title", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Contributors", Repeated: true, Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "Name", Required: true, Type: bigquery.StringFieldType},
+		}},
+		{Name: "Obsolete", Type: bigquery.StringFieldType},
+	}
+	desired := bigquery.Schema{
+		{Name: "ISBN", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Title", Required: false, Type: bigquery.StringFieldType},
+		{Name: "Sources", Repeated: true, Type: bigquery.StringFieldType},
+		{Name: "Contributors", Repeated: true, Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "Name", Required: true, Type: bigquery.StringFieldType},
+			{Name: "Reading", Type: bigquery.StringFieldType},
+		}},
+		{Name: "Price", Type: bigquery.IntegerFieldType},
+	}
+
+	migration := planSchemaMigration(live, desired)
+
+	assert.Empty(t, migration.problems)
+	assert.Equal(t, []string{
+		"relax column Title to NULLABLE",
+		"add column Sources STRING",
+		"add column Contributors.Reading STRING",
+		"add column Price INTEGER",
+	}, migration.changes)
+
+	var names []string
+	for _, field := range migration.schema {
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{"ISBN", "Title", "Contributors", "Obsolete", "Sources", "Price"}, names)
+	assert.False(t, migration.schema[1].Required)
+	assert.Equal(t, 2, len(migration.schema[2].Schema))
+	assert.True(t, live[1].Required, "the live schema should not be modified")
+}
+
+func TestPlanSchemaMigrationReportsIncompatibleChanges(t *testing.T) {
+	live := bigquery.Schema{
+		{Name: "ISBN", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Price", Type: bigquery.StringFieldType},
+		{Name: "Authors", Type: bigquery.StringFieldType},
+		{Name: "Sources", Type: bigquery.StringFieldType},
+	}
+	desired := bigquery.Schema{
+		{Name: "ISBN", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Price", Type: bigquery.IntegerFieldType},
+		{Name: "Authors", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Sources", Repeated: true, Type: bigquery.StringFieldType},
+		{Name: "UploadedDate", Required: true, Type: bigquery.DateFieldType},
+		{Name: "Contributors", Repeated: true, Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "Name", Required: true, Type: bigquery.StringFieldType},
+			{Name: "Reading", Type: bigquery.StringFieldType},
+		}},
+	}
+
+	migration := planSchemaMigration(live, desired)
+
+	assert.Equal(t, []string{
+		"column Price: type STRING cannot be changed to INTEGER",
+		"column Authors: nullable column cannot be made required",
+		"column Sources: mode NULLABLE cannot be changed to REPEATED",
+		"column UploadedDate: cannot add a required column to the existing rows",
+		"column Contributors.Name: cannot add a required column to the existing rows",
+	}, migration.problems)
+}
+
+func TestPlanSchemaMigrationFromBaselineSchema(t *testing.T) {
+	// The schema of the tables created before the details of ONIX were recorded.
+	live := bigquery.Schema{
+		{Name: "ISBN", Required: true, Type: bigquery.StringFieldType},
+		{Name: "PubDate", Required: true, Type: bigquery.DateFieldType},
+		{Name: "Title", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Url", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Authors", Required: false, Type: bigquery.StringFieldType},
+		{Name: "Publisher", Required: false, Type: bigquery.StringFieldType},
+		{Name: "Categories", Required: false, Type: bigquery.StringFieldType},
+		{Name: "Ccode", Required: false, Type: bigquery.StringFieldType},
+		{Name: "Target", Required: false, Type: bigquery.StringFieldType},
+		{Name: "Format", Required: false, Type: bigquery.StringFieldType},
+		{Name: "Content", Required: false, Type: bigquery.StringFieldType},
+		{Name: "CreatedAt", Required: false, Type: bigquery.TimestampFieldType},
+		{Name: "LastUpdatedAt", Required: false, Type: bigquery.TimestampFieldType},
+		{Name: "UploadedAt", Required: true, Type: bigquery.TimestampFieldType},
+		{Name: "UploadedDate", Required: true, Type: bigquery.DateFieldType},
+	}
+
+	migration := planSchemaMigration(live, bqSchema)
+
+	assert.Empty(t, migration.problems)
+	assert.Contains(t, migration.changes, "add column Contributors RECORD")
+	assert.Equal(t, len(bqSchema), len(migration.schema))
+	assert.Empty(t, planSchemaMigration(migration.schema, bqSchema).changes)
+}
@@ -0,0 +1,130 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/tatamiya/new-books-notification/src/models"
+	"google.golang.org/api/iterator"
+)
+
+var deliverySchema = bigquery.Schema{
+	{Name: "ISBN", Required: true, Type: bigquery.StringFieldType},
+	{Name: "Channel", Required: true, Type: bigquery.StringFieldType},
+	{Name: "Status", Required: true, Type: bigquery.StringFieldType},
+	{Name: "Message", Required: false, Type: bigquery.StringFieldType},
+	{Name: "UpdatedAt", Required: true, Type: bigquery.TimestampFieldType},
+}
+
+// trackingTablePattern limits the names of the tracking tables of SQLite and Postgres,
+// which are put in the statements as they are, to plain identifiers.
+var trackingTablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func checkTrackingTable(table string) error {
+	if !trackingTablePattern.MatchString(table) {
+		return fmt.Errorf("invalid name of the tracking table %q: must consist of letters, digits and \"_\"", table)
+	}
+	return nil
+}
+
+// BQNotificationTracker keeps the history of the deliveries to a channel in a BigQuery table.
+// Every change of the status is appended as a row, since rows in the streaming buffer cannot be updated,
+// and the latest row of each ISBN tells its current status.
+type BQNotificationTracker struct {
+	client      *bigquery.Client
+	table       *bigquery.Table
+	channel     string
+	retryWindow time.Duration
+	now         func() time.Time
+}
+
+// NewBQNotificationTracker tracks the deliveries to channel in the table of settings,
+// which is created when it does not exist unless settings.ReadOnly is set.
+// Deliveries older than retryWindow are neither retried nor regarded as sent.
+func NewBQNotificationTracker(ctx context.Context, settings *BQSettings, channel string, retryWindow time.Duration) (*BQNotificationTracker, error) {
+
+	client, err := bigquery.NewClient(ctx, settings.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to BigQuery: %s", err)
+	}
+	table := client.Dataset(settings.DatasetName).Table(settings.TableName)
+
+	tableMetadata, err := table.Metadata(ctx)
+	if settings.ReadOnly {
+		if err != nil {
+			return nil, fmt.Errorf("cannot find the table %s: %s", settings.TableName, err)
+		}
+	} else if err != nil {
+		log.Printf("Cannot find the table %s: %s", settings.TableName, err)
+		metadata := bigquery.TableMetadata{
+			Schema: deliverySchema,
+			TimePartitioning: &bigquery.TimePartitioning{
+				Type:  bigquery.DayPartitioningType,
+				Field: "UpdatedAt",
+			},
+		}
+		if err = table.Create(ctx, &metadata); err != nil {
+			return nil, fmt.Errorf("cannot create a table: %s", err)
+		}
+		log.Printf("Successfully created the table %s", settings.TableName)
+	} else if err = migrateSchema(ctx, table, tableMetadata, deliverySchema); err != nil {
+		return nil, err
+	}
+
+	return &BQNotificationTracker{
+		client:      client,
+		table:       table,
+		channel:     channel,
+		retryWindow: retryWindow,
+		now:         time.Now,
+	}, nil
+}
+
+// GetDeliveries returns the current deliveries to the channel within the retry window, by ISBN.
+func (t *BQNotificationTracker) GetDeliveries(ctx context.Context) (map[string]*models.Delivery, error) {
+
+	q := t.client.Query(`SELECT ISBN, Channel, Status, Message, UpdatedAt FROM ` + fullTableID(t.table) +
+		` WHERE Channel = @channel AND UpdatedAt >= @since`)
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "channel", Value: t.channel},
+		{Name: "since", Value: t.now().Add(-t.retryWindow)},
+	}
+
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+	var history []*models.Delivery
+	for {
+		var d models.Delivery
+		err := it.Next(&d)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Unexpected query results: %s", err)
+			continue
+		}
+		history = append(history, &d)
+	}
+
+	return models.LatestDeliveries(history), nil
+}
+
+// SaveDelivery appends the status of the delivery to the channel.
+func (t *BQNotificationTracker) SaveDelivery(ctx context.Context, delivery *models.Delivery) error {
+
+	row := *delivery
+	row.Channel = t.channel
+	row.UpdatedAt = t.now()
+
+	err := t.table.Inserter().Put(ctx, &bigquery.StructSaver{Schema: deliverySchema, Struct: &row})
+	if err != nil {
+		return fmt.Errorf("saving delivery of %s failed: %s", delivery.ISBN, err)
+	}
+	return nil
+}
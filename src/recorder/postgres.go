@@ -0,0 +1,376 @@
+package recorder
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/lib/pq"
+	"github.com/tatamiya/new-books-notification/src/models"
+)
+
+// postgresMigrations are applied in order, and the number of the applied ones is kept in schema_migrations.
+// Append a migration to change the schema; never edit the applied ones.
+var postgresMigrations = []string{
+	`CREATE TABLE books (
+		ISBN TEXT PRIMARY KEY,
+		PubDate DATE NOT NULL,
+		Title TEXT NOT NULL,
+		Url TEXT NOT NULL,
+		Sources TEXT[],
+		Authors TEXT,
+		Contributors JSONB,
+		Publisher TEXT,
+		Categories TEXT,
+		Ccode TEXT,
+		Target TEXT,
+		Format TEXT,
+		Content TEXT,
+		Ndc TEXT,
+		NdcClass TEXT,
+		NdcDivision TEXT,
+		GenreCode TEXT,
+		Price BIGINT,
+		Pages BIGINT,
+		Size TEXT,
+		TableOfContents TEXT,
+		Description TEXT,
+		Series TEXT,
+		Volume TEXT,
+		CoverUrl TEXT,
+		CreatedAt TIMESTAMPTZ,
+		LastUpdatedAt TIMESTAMPTZ,
+		UploadedAt TIMESTAMPTZ NOT NULL,
+		UploadedDate DATE NOT NULL
+	);
+	CREATE INDEX books_uploaded_date ON books (UploadedDate);
+	CREATE INDEX books_ccode ON books (Ccode);`,
+	`CREATE TABLE notifications (
+		ISBN TEXT NOT NULL,
+		Channel TEXT NOT NULL,
+		Status TEXT NOT NULL,
+		Message TEXT,
+		UpdatedAt TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX notifications_channel_updated_at ON notifications (Channel, UpdatedAt);`,
+	`ALTER TABLE books ADD COLUMN LastSeenDate DATE;
+	UPDATE books SET LastSeenDate = UploadedDate;
+	ALTER TABLE books ALTER COLUMN LastSeenDate SET NOT NULL;
+	CREATE INDEX books_last_seen_date ON books (LastSeenDate);`,
+}
+
+// postgresColumns are the columns of the books table in the order of the values given by postgresValues.
+var postgresColumns = []string{
+	"ISBN", "PubDate", "Title", "Url", "Sources", "Authors", "Contributors", "Publisher", "Categories", "Ccode",
+	"Target", "Format", "Content", "Ndc", "NdcClass", "NdcDivision", "GenreCode", "Price", "Pages", "Size",
+	"TableOfContents", "Description", "Series", "Volume", "CoverUrl", "CreatedAt", "LastUpdatedAt", "UploadedAt", "UploadedDate", "LastSeenDate",
+}
+
+// PostgresSettings holds the connection and its pool.
+// Zero values of the pool settings leave the defaults of database/sql.
+type PostgresSettings struct {
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	DedupWindowDays int
+	// ReadOnly skips the migrations, e.g. in a dry run which only looks up the recorded books.
+	ReadOnly bool
+}
+
+// PostgresRecorder records the books in a books table keyed by ISBN,
+// so that it can be joined with other data kept in Postgres.
+// A book recorded again is updated, keeping when it was first uploaded, as the upsert mode of BQRecorder,
+// and the books are looked up by LastSeenDate, the latest date they were recorded.
+type PostgresRecorder struct {
+	db              *sql.DB
+	dedupWindowDays int
+	readOnly        bool
+}
+
+func NewPostgresRecorder(ctx context.Context, settings *PostgresSettings) (*PostgresRecorder, error) {
+
+	db, err := sql.Open("postgres", settings.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to Postgres: %s", err)
+	}
+	if settings.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(settings.MaxOpenConns)
+	}
+	if settings.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(settings.MaxIdleConns)
+	}
+	if settings.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(settings.ConnMaxLifetime)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot connect to Postgres: %s", err)
+	}
+	if settings.ReadOnly {
+		return &PostgresRecorder{db: db, dedupWindowDays: settings.DedupWindowDays, readOnly: true}, nil
+	}
+	if err := migratePostgres(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot migrate Postgres database: %s", err)
+	}
+
+	return &PostgresRecorder{db: db, dedupWindowDays: settings.DedupWindowDays}, nil
+}
+
+func migratePostgres(ctx context.Context, db *sql.DB) error {
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Concurrent runs wait here until the first one has migrated.
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	var version int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(postgresMigrations); i++ {
+		if _, err := tx.ExecContext(ctx, postgresMigrations[i]); err != nil {
+			return fmt.Errorf("migration %d failed: %s", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, i+1); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %d of the Postgres database", i+1)
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresRecorder) Close() error {
+	return s.db.Close()
+}
+
+// postgresUpsert inserts a book, or updates the recorded one when any of its fields has changed.
+// LastSeenDate is one of them, so that a book recorded again on a later day is seen on that day.
+func postgresUpsert() string {
+
+	var placeholders, updates, changed []string
+	for i, column := range postgresColumns {
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+		if column == "ISBN" || column == "UploadedAt" || column == "UploadedDate" {
+			continue
+		}
+		updates = append(updates, fmt.Sprintf("%[1]s = EXCLUDED.%[1]s", column))
+		changed = append(changed, fmt.Sprintf("books.%[1]s IS DISTINCT FROM EXCLUDED.%[1]s", column))
+	}
+
+	return `INSERT INTO books (` + strings.Join(postgresColumns, ", ") + `) VALUES (` + strings.Join(placeholders, ", ") + `)` +
+		` ON CONFLICT (ISBN) DO UPDATE SET ` + strings.Join(updates, ", ") +
+		` WHERE ` + strings.Join(changed, " OR ")
+}
+
+func postgresValues(r *Record) ([]interface{}, error) {
+
+	contributors, err := json.Marshal(r.Contributors)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode contributors of %s: %s", r.ISBN, err)
+	}
+
+	return []interface{}{
+		r.ISBN, r.PubDate.String(), r.Title, r.Url, pq.Array(r.Sources), r.Authors, string(contributors), r.Publisher, r.Categories, r.Ccode,
+		r.Target, r.Format, r.Content, r.Ndc, r.NdcClass, r.NdcDivision, r.GenreCode,
+		sql.NullInt64{Int64: r.Price.Int64, Valid: r.Price.Valid}, sql.NullInt64{Int64: r.Pages.Int64, Valid: r.Pages.Valid}, r.Size,
+		r.TableOfContents, r.Description, r.Series, r.Volume, r.CoverUrl,
+		nullTimeIfZero(r.CreatedAt), nullTimeIfZero(r.LastUpdatedAt), r.UploadedAt, r.UploadedDate.String(), r.LastSeenDate.String(),
+	}, nil
+}
+
+func nullTimeIfZero(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (s *PostgresRecorder) SaveRecords(ctx context.Context, bookList *models.BookList) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("upload book records failed: %s", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, postgresUpsert())
+	if err != nil {
+		return fmt.Errorf("upload book records failed: %s", err)
+	}
+	defer stmt.Close()
+
+	for _, book := range bookList.Books {
+		values, err := postgresValues(convertIntoRecord(book, bookList.UploadDate))
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("upload book records failed: %s", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("upload book records failed: %s", err)
+	}
+	return nil
+}
+
+func (s *PostgresRecorder) GetRecordedISBN(ctx context.Context, targetDate time.Time) ([]string, error) {
+
+	condition, args := postgresDedupCondition(targetDate, s.dedupWindowDays)
+	rows, err := s.db.QueryContext(ctx, `SELECT ISBN FROM books WHERE `+condition, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+	defer rows.Close()
+
+	uploadedISBN := []string{}
+	for rows.Next() {
+		var isbn string
+		if err := rows.Scan(&isbn); err != nil {
+			log.Printf("Unexpected query results: %s", err)
+			continue
+		}
+		uploadedISBN = append(uploadedISBN, isbn)
+	}
+
+	return uploadedISBN, rows.Err()
+}
+
+// GetRecordedBooks returns the records of the books recorded in the dedup window, by ISBN.
+// Their UploadedDate is the date they were last recorded.
+func (s *PostgresRecorder) GetRecordedBooks(ctx context.Context, targetDate time.Time) (map[string]*models.RecordedBook, error) {
+
+	condition, args := postgresDedupCondition(targetDate, s.dedupWindowDays)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT ISBN, Title, Publisher, Price, PubDate, LastSeenDate FROM books WHERE `+condition, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+	defer rows.Close()
+
+	recordedBooks := make(map[string]*models.RecordedBook)
+	for rows.Next() {
+		var isbn, title string
+		var publisher sql.NullString
+		var price sql.NullInt64
+		var pubDate, uploadedDate time.Time
+		if err := rows.Scan(&isbn, &title, &publisher, &price, &pubDate, &uploadedDate); err != nil {
+			log.Printf("Unexpected query results: %s", err)
+			continue
+		}
+		recordedBooks[isbn] = &models.RecordedBook{
+			Isbn:         isbn,
+			Title:        title,
+			Publisher:    publisher.String,
+			Price:        int(price.Int64),
+			PubDate:      civil.DateOf(pubDate).In(targetDate.Location()),
+			UploadedDate: civil.DateOf(uploadedDate).In(targetDate.Location()),
+		}
+	}
+
+	return recordedBooks, rows.Err()
+}
+
+// postgresDedupCondition limits the records to the dedup window up to targetDate, as queryBuilder.dedupCondition.
+func postgresDedupCondition(targetDate time.Time, dedupWindowDays int) (string, []interface{}) {
+	to := civil.DateOf(targetDate).String()
+	if dedupWindowDays < 0 {
+		return "LastSeenDate <= $1", []interface{}{to}
+	}
+	if dedupWindowDays <= 1 {
+		return "LastSeenDate = $1", []interface{}{to}
+	}
+	from := civil.DateOf(targetDate.AddDate(0, 0, 1-dedupWindowDays)).String()
+	return "LastSeenDate BETWEEN $1 AND $2", []interface{}{from, to}
+}
+
+// NotificationTracker tracks the deliveries to channel in table of the same database,
+// which is created when it does not exist unless the recorder is read-only.
+// The "notifications" table is created by the migrations.
+func (s *PostgresRecorder) NotificationTracker(ctx context.Context, table string, channel string, retryWindow time.Duration) (*PostgresNotificationTracker, error) {
+
+	if err := checkTrackingTable(table); err != nil {
+		return nil, err
+	}
+	if !s.readOnly {
+		_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+			ISBN TEXT NOT NULL,
+			Channel TEXT NOT NULL,
+			Status TEXT NOT NULL,
+			Message TEXT,
+			UpdatedAt TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS `+table+`_channel_updated_at ON `+table+` (Channel, UpdatedAt);`)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create the table %s: %s", table, err)
+		}
+	}
+
+	return &PostgresNotificationTracker{db: s.db, table: table, channel: channel, retryWindow: retryWindow, now: time.Now}, nil
+}
+
+// PostgresNotificationTracker is the Postgres counterpart of BQNotificationTracker.
+type PostgresNotificationTracker struct {
+	db          *sql.DB
+	table       string
+	channel     string
+	retryWindow time.Duration
+	now         func() time.Time
+}
+
+// GetDeliveries returns the current deliveries to the channel within the retry window, by ISBN.
+func (t *PostgresNotificationTracker) GetDeliveries(ctx context.Context) (map[string]*models.Delivery, error) {
+
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT ISBN, Channel, Status, Message, UpdatedAt FROM `+t.table+` WHERE Channel = $1 AND UpdatedAt >= $2`,
+		t.channel, t.now().Add(-t.retryWindow))
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+	defer rows.Close()
+
+	var history []*models.Delivery
+	for rows.Next() {
+		var d models.Delivery
+		var status string
+		var message sql.NullString
+		if err := rows.Scan(&d.ISBN, &d.Channel, &status, &message, &d.UpdatedAt); err != nil {
+			log.Printf("Unexpected query results: %s", err)
+			continue
+		}
+		d.Status = models.DeliveryStatus(status)
+		d.Message = message.String
+		history = append(history, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+
+	return models.LatestDeliveries(history), nil
+}
+
+// SaveDelivery appends the status of the delivery to the channel.
+func (t *PostgresNotificationTracker) SaveDelivery(ctx context.Context, delivery *models.Delivery) error {
+	_, err := t.db.ExecContext(ctx,
+		`INSERT INTO `+t.table+` (ISBN, Channel, Status, Message, UpdatedAt) VALUES ($1, $2, $3, $4, $5)`,
+		delivery.ISBN, t.channel, string(delivery.Status), delivery.Message, t.now())
+	if err != nil {
+		return fmt.Errorf("saving delivery of %s failed: %s", delivery.ISBN, err)
+	}
+	return nil
+}
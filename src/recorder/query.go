@@ -0,0 +1,95 @@
+package recorder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+// queryBuilder builds the SQL run by BQRecorder, apart from the client so that it can be tested offline.
+// Values are passed as query parameters; only the table names, which cannot be parameterized, are embedded.
+// With merged records, the books are looked up by the date they were last seen rather than first uploaded,
+// which falls back to UploadedDate for the rows recorded before LastSeenDate was added.
+type queryBuilder struct {
+	tableID         string
+	dedupWindowDays int
+	merged          bool
+}
+
+func newQueryBuilder(table *bigquery.Table, dedupWindowDays int, merged bool) queryBuilder {
+	return queryBuilder{tableID: fullTableID(table), dedupWindowDays: dedupWindowDays, merged: merged}
+}
+
+// recordedDate is the date on which a book was last recorded.
+func (b queryBuilder) recordedDate() string {
+	if b.merged {
+		return "COALESCE(LastSeenDate, UploadedDate)"
+	}
+	return "UploadedDate"
+}
+
+func fullTableID(table *bigquery.Table) string {
+	return fmt.Sprintf("`%s.%s.%s`", table.ProjectID, table.DatasetID, table.TableID)
+}
+
+// dedupCondition limits the records to the dedup window up to targetDate.
+func (b queryBuilder) dedupCondition(targetDate time.Time) (string, []bigquery.QueryParameter) {
+	to := bigquery.QueryParameter{Name: "to", Value: civil.DateOf(targetDate)}
+	if b.dedupWindowDays < 0 {
+		return b.recordedDate() + " <= @to", []bigquery.QueryParameter{to}
+	}
+	if b.dedupWindowDays <= 1 {
+		return b.recordedDate() + " = @to", []bigquery.QueryParameter{to}
+	}
+	from := bigquery.QueryParameter{Name: "from", Value: civil.DateOf(targetDate.AddDate(0, 0, 1-b.dedupWindowDays))}
+	return b.recordedDate() + " BETWEEN @from AND @to", []bigquery.QueryParameter{from, to}
+}
+
+func (b queryBuilder) recordedISBN(targetDate time.Time) (string, []bigquery.QueryParameter) {
+	condition, params := b.dedupCondition(targetDate)
+	return `SELECT DISTINCT ISBN FROM ` + b.tableID + ` WHERE ` + condition, params
+}
+
+func (b queryBuilder) recordedBooks(targetDate time.Time) (string, []bigquery.QueryParameter) {
+	condition, params := b.dedupCondition(targetDate)
+	return `SELECT ISBN, Title, Publisher, Price, PubDate, ` + b.recordedDate() + ` AS UploadedDate FROM ` + b.tableID +
+		` WHERE ` + condition +
+		` QUALIFY ROW_NUMBER() OVER (PARTITION BY ISBN ORDER BY UploadedAt DESC) = 1`, params
+}
+
+// mergeFromStaging upserts the records loaded into the staging table on ISBN.
+// A recorded book is updated only when any of its fields has changed, keeping when it was first uploaded,
+// and a new book is inserted as it is. LastSeenDate is updated either way, so that the book is regarded as recorded.
+func (b queryBuilder) mergeFromStaging(stagingTableID string, schema bigquery.Schema) string {
+
+	var columns, sourceColumns, changed, updates []string
+	seen := ""
+	for _, field := range schema {
+		columns = append(columns, field.Name)
+		sourceColumns = append(sourceColumns, "S."+field.Name)
+		if field.Name == "ISBN" || field.Name == "UploadedAt" || field.Name == "UploadedDate" {
+			continue
+		}
+		if field.Name == "LastSeenDate" {
+			updates = append(updates, "LastSeenDate = S.LastSeenDate")
+			seen = ` WHEN MATCHED THEN UPDATE SET LastSeenDate = S.LastSeenDate`
+			continue
+		}
+		if field.Repeated {
+			// Arrays cannot be compared directly.
+			changed = append(changed, fmt.Sprintf("TO_JSON_STRING(T.%[1]s) != TO_JSON_STRING(S.%[1]s)", field.Name))
+		} else {
+			changed = append(changed, fmt.Sprintf("T.%[1]s IS DISTINCT FROM S.%[1]s", field.Name))
+		}
+		updates = append(updates, fmt.Sprintf("%[1]s = S.%[1]s", field.Name))
+	}
+
+	return `MERGE ` + b.tableID + ` T` +
+		` USING (SELECT * FROM ` + stagingTableID + ` WHERE TRUE QUALIFY ROW_NUMBER() OVER (PARTITION BY ISBN ORDER BY UploadedAt DESC) = 1) S` +
+		` ON T.ISBN = S.ISBN` +
+		` WHEN MATCHED AND (` + strings.Join(changed, " OR ") + `) THEN UPDATE SET ` + strings.Join(updates, ", ") + seen +
+		` WHEN NOT MATCHED THEN INSERT (` + strings.Join(columns, ", ") + `) VALUES (` + strings.Join(sourceColumns, ", ") + `)`
+}
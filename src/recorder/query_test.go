@@ -0,0 +1,73 @@
+package recorder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordedISBNQueryOfDedupWindow(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	to := bigquery.QueryParameter{Name: "to", Value: civil.Date{Year: 2024, Month: time.August, Day: 1}}
+
+	testCases := []struct {
+		days           int
+		expectedSQL    string
+		expectedParams []bigquery.QueryParameter
+	}{
+		{0, "SELECT DISTINCT ISBN FROM `p.d.t` WHERE UploadedDate = @to", []bigquery.QueryParameter{to}},
+		{1, "SELECT DISTINCT ISBN FROM `p.d.t` WHERE UploadedDate = @to", []bigquery.QueryParameter{to}},
+		{
+			7,
+			"SELECT DISTINCT ISBN FROM `p.d.t` WHERE UploadedDate BETWEEN @from AND @to",
+			[]bigquery.QueryParameter{{Name: "from", Value: civil.Date{Year: 2024, Month: time.July, Day: 26}}, to},
+		},
+		{-1, "SELECT DISTINCT ISBN FROM `p.d.t` WHERE UploadedDate <= @to", []bigquery.QueryParameter{to}},
+	}
+	for _, tc := range testCases {
+		queries := queryBuilder{tableID: "`p.d.t`", dedupWindowDays: tc.days}
+		sql, params := queries.recordedISBN(date)
+		assert.Equal(t, tc.expectedSQL, sql)
+		assert.Equal(t, tc.expectedParams, params)
+	}
+}
+
+func TestRecordedQueriesOfMergedRecordsUseLastSeenDate(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	queries := queryBuilder{tableID: "`p.d.t`", dedupWindowDays: 1, merged: true}
+
+	sql, _ := queries.recordedISBN(date)
+	assert.Equal(t, "SELECT DISTINCT ISBN FROM `p.d.t` WHERE COALESCE(LastSeenDate, UploadedDate) = @to", sql)
+
+	sql, _ = queries.recordedBooks(date)
+	assert.Contains(t, sql, "SELECT ISBN, Title, Publisher, Price, PubDate, COALESCE(LastSeenDate, UploadedDate) AS UploadedDate FROM `p.d.t` WHERE COALESCE(LastSeenDate, UploadedDate) = @to")
+}
+
+func TestMergeFromStagingQuery(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "ISBN", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Title", Required: true, Type: bigquery.StringFieldType},
+		{Name: "Sources", Repeated: true, Type: bigquery.StringFieldType},
+		{Name: "LastUpdatedAt", Type: bigquery.TimestampFieldType},
+		{Name: "UploadedAt", Required: true, Type: bigquery.TimestampFieldType},
+		{Name: "UploadedDate", Required: true, Type: bigquery.DateFieldType},
+		{Name: "LastSeenDate", Type: bigquery.DateFieldType},
+	}
+	queries := queryBuilder{tableID: "`p.d.t`", merged: true}
+
+	sql := queries.mergeFromStaging("`p.d.t_staging`", schema)
+
+	assert.True(t, strings.HasPrefix(sql, "MERGE `p.d.t` T USING (SELECT * FROM `p.d.t_staging` "))
+	assert.Contains(t, sql, " ON T.ISBN = S.ISBN ")
+	assert.Contains(t, sql, "WHEN MATCHED AND (T.Title IS DISTINCT FROM S.Title OR TO_JSON_STRING(T.Sources) != TO_JSON_STRING(S.Sources) OR T.LastUpdatedAt IS DISTINCT FROM S.LastUpdatedAt)")
+	assert.Contains(t, sql, "THEN UPDATE SET Title = S.Title, Sources = S.Sources, LastUpdatedAt = S.LastUpdatedAt, LastSeenDate = S.LastSeenDate"+
+		" WHEN MATCHED THEN UPDATE SET LastSeenDate = S.LastSeenDate WHEN NOT MATCHED")
+	assert.True(t, strings.HasSuffix(sql, "INSERT (ISBN, Title, Sources, LastUpdatedAt, UploadedAt, UploadedDate, LastSeenDate)"+
+		" VALUES (S.ISBN, S.Title, S.Sources, S.LastUpdatedAt, S.UploadedAt, S.UploadedDate, S.LastSeenDate)"))
+}
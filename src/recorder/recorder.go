@@ -1,7 +1,9 @@
 package recorder
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"time"
@@ -17,35 +19,77 @@ var bqSchema = bigquery.Schema{
 	{Name: "PubDate", Required: true, Type: bigquery.DateFieldType},
 	{Name: "Title", Required: true, Type: bigquery.StringFieldType},
 	{Name: "Url", Required: true, Type: bigquery.StringFieldType},
+	{Name: "Sources", Repeated: true, Type: bigquery.StringFieldType},
 	{Name: "Authors", Required: false, Type: bigquery.StringFieldType},
+	{Name: "Contributors", Repeated: true, Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+		{Name: "Name", Required: false, Type: bigquery.StringFieldType},
+		{Name: "Reading", Required: false, Type: bigquery.StringFieldType},
+		{Name: "Role", Required: false, Type: bigquery.StringFieldType},
+	}},
 	{Name: "Publisher", Required: false, Type: bigquery.StringFieldType},
 	{Name: "Categories", Required: false, Type: bigquery.StringFieldType},
 	{Name: "Ccode", Required: false, Type: bigquery.StringFieldType},
 	{Name: "Target", Required: false, Type: bigquery.StringFieldType},
 	{Name: "Format", Required: false, Type: bigquery.StringFieldType},
 	{Name: "Content", Required: false, Type: bigquery.StringFieldType},
+	{Name: "Ndc", Required: false, Type: bigquery.StringFieldType},
+	{Name: "NdcClass", Required: false, Type: bigquery.StringFieldType},
+	{Name: "NdcDivision", Required: false, Type: bigquery.StringFieldType},
+	{Name: "GenreCode", Required: false, Type: bigquery.StringFieldType},
+	{Name: "Price", Required: false, Type: bigquery.IntegerFieldType},
+	{Name: "Pages", Required: false, Type: bigquery.IntegerFieldType},
+	{Name: "Size", Required: false, Type: bigquery.StringFieldType},
+	{Name: "TableOfContents", Required: false, Type: bigquery.StringFieldType},
+	{Name: "Description", Required: false, Type: bigquery.StringFieldType},
+	{Name: "Series", Required: false, Type: bigquery.StringFieldType},
+	{Name: "Volume", Required: false, Type: bigquery.StringFieldType},
+	{Name: "CoverUrl", Required: false, Type: bigquery.StringFieldType},
 	{Name: "CreatedAt", Required: false, Type: bigquery.TimestampFieldType},
 	{Name: "LastUpdatedAt", Required: false, Type: bigquery.TimestampFieldType},
 	{Name: "UploadedAt", Required: true, Type: bigquery.TimestampFieldType},
 	{Name: "UploadedDate", Required: true, Type: bigquery.DateFieldType},
+	// LastSeenDate is the latest date the book was recorded, which differs from UploadedDate
+	// when the records are merged on ISBN. It is NULL in the rows appended before it was added.
+	{Name: "LastSeenDate", Required: false, Type: bigquery.DateFieldType},
+}
+
+type ContributorRecord struct {
+	Name    string
+	Reading string
+	Role    string
 }
 
 type Record struct {
-	ISBN          string
-	Title         string
-	Url           string
-	Authors       string
-	Publisher     string
-	Categories    string
-	Ccode         string
-	Target        string
-	Format        string
-	Content       string
-	PubDate       civil.Date
-	CreatedAt     time.Time
-	LastUpdatedAt time.Time
-	UploadedAt    time.Time
-	UploadedDate  civil.Date
+	ISBN            string
+	Title           string
+	Url             string
+	Sources         []string
+	Authors         string
+	Contributors    []ContributorRecord
+	Publisher       string
+	Categories      string
+	Ccode           string
+	Target          string
+	Format          string
+	Content         string
+	Ndc             string
+	NdcClass        string
+	NdcDivision     string
+	GenreCode       string
+	Price           bigquery.NullInt64
+	Pages           bigquery.NullInt64
+	Size            string
+	TableOfContents string
+	Description     string
+	Series          string
+	Volume          string
+	CoverUrl        string
+	PubDate         civil.Date
+	CreatedAt       time.Time
+	LastUpdatedAt   time.Time
+	UploadedAt      time.Time
+	UploadedDate    civil.Date
+	LastSeenDate    civil.Date
 }
 
 func prepareUploadRecords(bookList *models.BookList) []*bigquery.StructSaver {
@@ -67,27 +111,66 @@ func prepareUploadRecords(bookList *models.BookList) []*bigquery.StructSaver {
 func convertIntoRecord(book *models.Book, uploadedAt time.Time) *Record {
 
 	return &Record{
-		ISBN:          book.Isbn,
-		Title:         book.Title,
-		Url:           book.Url,
-		Authors:       book.Authors,
-		Publisher:     book.Publisher,
-		Categories:    book.Categories,
-		Ccode:         book.Ccode,
-		Target:        book.Target,
-		Format:        book.Format,
-		Content:       book.Content,
-		PubDate:       civil.DateOf(book.PubDate),
-		CreatedAt:     book.CreatedDate,
-		LastUpdatedAt: book.LastUpdatedDate,
-		UploadedAt:    uploadedAt,
-		UploadedDate:  civil.DateOf(uploadedAt),
+		ISBN:            book.Isbn,
+		Title:           book.Title,
+		Url:             book.Url,
+		Sources:         append([]string{}, book.Sources...),
+		Authors:         book.Authors,
+		Contributors:    convertIntoContributorRecords(book.Contributors),
+		Publisher:       book.Publisher,
+		Categories:      book.Categories,
+		Ccode:           book.Ccode,
+		Target:          book.Target,
+		Format:          book.Format,
+		Content:         book.Content,
+		Ndc:             book.Ndc,
+		NdcClass:        book.NdcClass,
+		NdcDivision:     book.NdcDivision,
+		GenreCode:       book.GenreCode,
+		Price:           nullIntIfZero(book.Price),
+		Pages:           nullIntIfZero(book.Pages),
+		Size:            book.Size,
+		TableOfContents: book.TableOfContents,
+		Description:     book.Description,
+		Series:          book.Series,
+		Volume:          book.Volume,
+		CoverUrl:        book.CoverURL,
+		PubDate:         civil.DateOf(book.PubDate),
+		CreatedAt:       book.CreatedDate,
+		LastUpdatedAt:   book.LastUpdatedDate,
+		UploadedAt:      uploadedAt,
+		UploadedDate:    civil.DateOf(uploadedAt),
+		LastSeenDate:    civil.DateOf(uploadedAt),
+	}
+}
+
+// convertIntoContributorRecords returns an empty slice rather than nil for a book without contributors,
+// since a JSON load of BigQuery may reject null for a repeated column.
+func convertIntoContributorRecords(contributors []models.Contributor) []ContributorRecord {
+	records := []ContributorRecord{}
+	for _, contributor := range contributors {
+		records = append(records, ContributorRecord{
+			Name:    contributor.Name,
+			Reading: contributor.Reading,
+			Role:    string(contributor.Role),
+		})
 	}
+	return records
+}
+
+// nullIntIfZero records unknown numbers, which are left zero by the fetcher, as NULL.
+func nullIntIfZero(n int) bigquery.NullInt64 {
+	if n == 0 {
+		return bigquery.NullInt64{}
+	}
+	return bigquery.NullInt64{Int64: int64(n), Valid: true}
 }
 
 type BQRecorder struct {
-	client *bigquery.Client
-	table  *bigquery.Table
+	client  *bigquery.Client
+	table   *bigquery.Table
+	queries queryBuilder
+	upsert  bool
 }
 
 func (s *BQRecorder) createTable(ctx context.Context) error {
@@ -102,10 +185,18 @@ func (s *BQRecorder) createTable(ctx context.Context) error {
 	return s.table.Create(ctx, &metadata)
 }
 
+// DedupWindowDays is the number of days up to the target date in which recorded books are looked up.
+// Zero or one means the target date only, and a negative value means all time.
+// With Upsert, the records are merged on ISBN so that the table holds one current row per book,
+// instead of being appended by the streaming inserter.
+// With ReadOnly, the table is neither created nor migrated, e.g. in a dry run which only looks up the recorded books.
 type BQSettings struct {
-	ProjectID   string
-	DatasetName string
-	TableName   string
+	ProjectID       string
+	DatasetName     string
+	TableName       string
+	DedupWindowDays int
+	Upsert          bool
+	ReadOnly        bool
 }
 
 func NewBQRecorder(ctx context.Context, settings *BQSettings) (*BQRecorder, error) {
@@ -117,21 +208,38 @@ func NewBQRecorder(ctx context.Context, settings *BQSettings) (*BQRecorder, erro
 	dataset := client.Dataset(settings.DatasetName)
 	table := dataset.Table(settings.TableName)
 
-	recorder := BQRecorder{client: client, table: table}
+	recorder := BQRecorder{
+		client:  client,
+		table:   table,
+		queries: newQueryBuilder(table, settings.DedupWindowDays, settings.Upsert),
+		upsert:  settings.Upsert,
+	}
 
-	_, err = table.Metadata(ctx)
+	metadata, err := table.Metadata(ctx)
+	if settings.ReadOnly {
+		if err != nil {
+			return nil, fmt.Errorf("cannot find the table %s: %s", settings.TableName, err)
+		}
+		return &recorder, nil
+	}
 	if err != nil {
 		log.Printf("Cannot find the table %s: %s", settings.TableName, err)
 		if err = recorder.createTable(ctx); err != nil {
 			return nil, fmt.Errorf("cannot create a table: %s", err)
 		}
 		log.Printf("Successfully created the table %s", settings.TableName)
+	} else if err = migrateSchema(ctx, table, metadata, bqSchema); err != nil {
+		return nil, err
 	}
 
 	return &recorder, nil
 }
 
 func (s *BQRecorder) SaveRecords(ctx context.Context, bookList *models.BookList) error {
+	if s.upsert {
+		return s.upsertRecords(ctx, bookList)
+	}
+
 	records := prepareUploadRecords(bookList)
 
 	inserter := s.table.Inserter()
@@ -143,12 +251,82 @@ func (s *BQRecorder) SaveRecords(ctx context.Context, bookList *models.BookList)
 	return nil
 }
 
+// upsertRecords loads the records into a staging table, which expires in a day in case it is left,
+// and merges them into the table.
+func (s *BQRecorder) upsertRecords(ctx context.Context, bookList *models.BookList) error {
+	if len(bookList.Books) == 0 {
+		return nil
+	}
+
+	data, err := EncodeJSONLines(bookList)
+	if err != nil {
+		return fmt.Errorf("cannot encode book records: %s", err)
+	}
+
+	staging := s.client.Dataset(s.table.DatasetID).Table(fmt.Sprintf("%s_staging_%d", s.table.TableID, time.Now().UnixNano()))
+	metadata := bigquery.TableMetadata{
+		Schema:         bqSchema,
+		ExpirationTime: time.Now().Add(24 * time.Hour),
+	}
+	if err := staging.Create(ctx, &metadata); err != nil {
+		return fmt.Errorf("cannot create a staging table: %s", err)
+	}
+	defer func() {
+		if err := staging.Delete(ctx); err != nil {
+			log.Printf("Cannot delete the staging table %s: %s", staging.TableID, err)
+		}
+	}()
+
+	source := bigquery.NewReaderSource(bytes.NewReader(data))
+	source.SourceFormat = bigquery.JSON
+	source.Schema = bqSchema
+	loader := staging.LoaderFrom(source)
+	loader.WriteDisposition = bigquery.WriteTruncate
+	if err := runJob(ctx, loader); err != nil {
+		return fmt.Errorf("loading book records into the staging table failed: %s", err)
+	}
+
+	q := s.client.Query(s.queries.mergeFromStaging(fullTableID(staging), bqSchema))
+	if err := runJob(ctx, q); err != nil {
+		return fmt.Errorf("merging book records failed: %s", err)
+	}
+
+	return nil
+}
+
+// EncodeJSONLines writes the records as newline delimited JSON to be loaded, or to be archived.
+func EncodeJSONLines(bookList *models.BookList) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, book := range bookList.Books {
+		if err := encoder.Encode(convertIntoRecord(book, bookList.UploadDate)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+type jobRunner interface {
+	Run(context.Context) (*bigquery.Job, error)
+}
+
+func runJob(ctx context.Context, runner jobRunner) error {
+	job, err := runner.Run(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
 func (s *BQRecorder) GetRecordedISBN(ctx context.Context, targetDate time.Time) ([]string, error) {
 
-	table := s.table
-	fullTableID := fmt.Sprintf("`%s.%s.%s`", table.ProjectID, table.DatasetID, table.TableID)
-	uploadedDate := fmt.Sprintf("\"%s\"", targetDate.Format("2006-01-02"))
-	q := s.client.Query(`SELECT DISTINCT ISBN FROM ` + fullTableID + ` WHERE UploadedDate=` + uploadedDate)
+	sql, params := s.queries.recordedISBN(targetDate)
+	q := s.client.Query(sql)
+	q.Parameters = params
 
 	it, err := q.Read(ctx)
 	if err != nil {
@@ -173,3 +351,46 @@ func (s *BQRecorder) GetRecordedISBN(ctx context.Context, targetDate time.Time)
 
 	return uploadedISBN, nil
 }
+
+// GetRecordedBooks returns the latest records of the books recorded in the dedup window, by ISBN.
+func (s *BQRecorder) GetRecordedBooks(ctx context.Context, targetDate time.Time) (map[string]*models.RecordedBook, error) {
+
+	sql, params := s.queries.recordedBooks(targetDate)
+	q := s.client.Query(sql)
+	q.Parameters = params
+
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+	type QueryResult struct {
+		ISBN         string
+		Title        string
+		Publisher    bigquery.NullString
+		Price        bigquery.NullInt64
+		PubDate      civil.Date
+		UploadedDate civil.Date
+	}
+	recordedBooks := make(map[string]*models.RecordedBook)
+	for {
+		var r QueryResult
+		err := it.Next(&r)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Unexpected query results: %s", err)
+			continue
+		}
+		recordedBooks[r.ISBN] = &models.RecordedBook{
+			Isbn:         r.ISBN,
+			Title:        r.Title,
+			Publisher:    r.Publisher.StringVal,
+			Price:        int(r.Price.Int64),
+			PubDate:      r.PubDate.In(targetDate.Location()),
+			UploadedDate: r.UploadedDate.In(targetDate.Location()),
+		}
+	}
+
+	return recordedBooks, nil
+}
@@ -3,9 +3,11 @@ package recorder
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/civil"
 	"github.com/stretchr/testify/assert"
 	"github.com/tatamiya/new-books-notification/src/models"
@@ -38,6 +40,8 @@ func TestConvertBookIntoRecordCorrectly(t *testing.T) {
 		Authors:       "tatamiya tamiya",
 		Publisher:     "畳屋書店",
 		Url:           "http://example.com/bd/isbn/1111111111111",
+		Sources:       []string{},
+		Contributors:  []ContributorRecord{},
 		PubDate:       civil.DateOf(date),
 		Categories:    "自然科学",
 		Ccode:         "1042",
@@ -48,6 +52,7 @@ func TestConvertBookIntoRecordCorrectly(t *testing.T) {
 		CreatedAt:     date,
 		UploadedAt:    uploadedDate,
 		UploadedDate:  civil.DateOf(uploadedDate),
+		LastSeenDate:  civil.DateOf(uploadedDate),
 	}
 
 	assert.EqualValues(t, &expectedRecord, actualRecord)
@@ -156,3 +161,89 @@ func TestGetEmptyWhenNoRecordIsUploaded(t *testing.T) {
 	assert.EqualValues(t, []string{}, actualUploadedISBN)
 
 }
+
+func TestConvertBookWithRichMetadataIntoRecord(t *testing.T) {
+
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date := time.Date(2024, time.August, 31, 12, 13, 24, 0, loc)
+	inputBook := models.Book{
+		Isbn:            "1111111111111",
+		Title:           "ご冗談でしょう、tatamiyaさん",
+		Url:             "http://example.com/bd/isbn/1111111111111",
+		PubDate:         date,
+		Ndc:             "913.6",
+		NdcClass:        "文学",
+		NdcDivision:     "日本文学",
+		GenreCode:       "01",
+		Price:           2400,
+		Pages:           0,
+		Size:            "188x128mm",
+		TableOfContents: "第1章 い草",
+		Description:     "畳にまつわる物理学の本",
+		Series:          "シリーズ畳の不思議",
+		Volume:          "1",
+		CoverURL:        "https://cover.openbd.jp/1111111111111.jpg",
+		Contributors: []models.Contributor{
+			{Name: "tatamiya tamiya", Reading: "タタミヤ タミヤ", Role: models.RoleAuthor},
+			{Name: "畳の科学", Role: models.RoleSupervisor},
+		},
+	}
+	uploadedDate := time.Date(2022, time.August, 1, 12, 30, 0, 0, loc)
+
+	actualRecord := convertIntoRecord(&inputBook, uploadedDate)
+
+	assert.Equal(t, "913.6", actualRecord.Ndc)
+	assert.Equal(t, "文学", actualRecord.NdcClass)
+	assert.Equal(t, "日本文学", actualRecord.NdcDivision)
+	assert.Equal(t, "01", actualRecord.GenreCode)
+	assert.Equal(t, bigquery.NullInt64{Int64: 2400, Valid: true}, actualRecord.Price)
+	assert.Equal(t, bigquery.NullInt64{}, actualRecord.Pages)
+	assert.Equal(t, "188x128mm", actualRecord.Size)
+	assert.Equal(t, "第1章 い草", actualRecord.TableOfContents)
+	assert.Equal(t, "畳にまつわる物理学の本", actualRecord.Description)
+	assert.Equal(t, "シリーズ畳の不思議", actualRecord.Series)
+	assert.Equal(t, "1", actualRecord.Volume)
+	assert.Equal(t, "https://cover.openbd.jp/1111111111111.jpg", actualRecord.CoverUrl)
+	assert.EqualValues(t, []ContributorRecord{
+		{Name: "tatamiya tamiya", Reading: "タタミヤ タミヤ", Role: "author"},
+		{Name: "畳の科学", Role: "supervisor"},
+	}, actualRecord.Contributors)
+}
+
+func TestEncodeRecordsAsJSONLines(t *testing.T) {
+
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	pubDate := time.Date(2024, time.September, 1, 0, 0, 0, 0, loc)
+	uploadedDate := time.Date(2024, time.August, 1, 12, 30, 0, 0, loc)
+	bookList := models.BookList{UploadDate: uploadedDate, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "Book1", PubDate: pubDate, Price: 2400},
+		{Isbn: "2222222222222", Title: "Book2", PubDate: pubDate},
+	}}
+
+	data, err := EncodeJSONLines(&bookList)
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[0], `"ISBN":"1111111111111"`)
+	assert.Contains(t, lines[0], `"Price":2400`)
+	assert.Contains(t, lines[0], `"PubDate":"2024-09-01"`)
+	assert.Contains(t, lines[0], `"UploadedDate":"2024-08-01"`)
+	assert.Contains(t, lines[1], `"Price":null`)
+}
+
+func TestEncodeBookWithoutContributorsAsEmptyArrays(t *testing.T) {
+
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	uploadedDate := time.Date(2024, time.August, 1, 12, 30, 0, 0, loc)
+	bookList := models.BookList{UploadDate: uploadedDate, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "Book1", PubDate: uploadedDate},
+	}}
+
+	data, err := EncodeJSONLines(&bookList)
+	assert.Nil(t, err)
+
+	assert.Contains(t, string(data), `"Sources":[]`)
+	assert.Contains(t, string(data), `"Contributors":[]`)
+	assert.NotContains(t, string(data), `null,"Contributors"`)
+}
@@ -0,0 +1,358 @@
+package recorder
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/civil"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/tatamiya/new-books-notification/src/models"
+)
+
+// Timestamps are stored in UTC with a fixed width so that they are ordered as strings.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// sqliteMigrations are applied in order to the database, whose PRAGMA user_version tells how many have been applied.
+// Append a migration to change the schema; never edit the applied ones.
+var sqliteMigrations = []string{
+	`CREATE TABLE books (
+		ISBN TEXT NOT NULL,
+		PubDate TEXT NOT NULL,
+		Title TEXT NOT NULL,
+		Url TEXT NOT NULL,
+		Sources TEXT,
+		Authors TEXT,
+		Contributors TEXT,
+		Publisher TEXT,
+		Categories TEXT,
+		Ccode TEXT,
+		Target TEXT,
+		Format TEXT,
+		Content TEXT,
+		Ndc TEXT,
+		NdcClass TEXT,
+		NdcDivision TEXT,
+		GenreCode TEXT,
+		Price INTEGER,
+		Pages INTEGER,
+		Size TEXT,
+		TableOfContents TEXT,
+		Description TEXT,
+		Series TEXT,
+		Volume TEXT,
+		CoverUrl TEXT,
+		CreatedAt TEXT,
+		LastUpdatedAt TEXT,
+		UploadedAt TEXT NOT NULL,
+		UploadedDate TEXT NOT NULL
+	);
+	CREATE INDEX books_uploaded_date ON books (UploadedDate);
+	CREATE INDEX books_isbn ON books (ISBN);`,
+	`CREATE TABLE notifications (
+		ISBN TEXT NOT NULL,
+		Channel TEXT NOT NULL,
+		Status TEXT NOT NULL,
+		Message TEXT,
+		UpdatedAt TEXT NOT NULL
+	);
+	CREATE INDEX notifications_channel_updated_at ON notifications (Channel, UpdatedAt);`,
+}
+
+// SQLiteRecorder records the books in a local SQLite database with the same columns as Record,
+// for deployments without GCP. Repeated columns are stored as JSON.
+type SQLiteRecorder struct {
+	db              *sql.DB
+	dedupWindowDays int
+	readOnly        bool
+}
+
+// NewSQLiteRecorder opens the database at path, creating it if needed, and applies the pending migrations.
+// dedupWindowDays is interpreted as in BQSettings.
+func NewSQLiteRecorder(path string, dedupWindowDays int) (*SQLiteRecorder, error) {
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open SQLite database %s: %s", path, err)
+	}
+	// SQLite allows one writer at a time.
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot migrate SQLite database %s: %s", path, err)
+	}
+
+	return &SQLiteRecorder{db: db, dedupWindowDays: dedupWindowDays}, nil
+}
+
+// NewReadOnlySQLiteRecorder opens the existing database at path to look up the recorded books only,
+// e.g. in a dry run, without creating or migrating it.
+func NewReadOnlySQLiteRecorder(path string, dedupWindowDays int) (*SQLiteRecorder, error) {
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("cannot open SQLite database %s: %s", path, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot open SQLite database %s: %s", path, err)
+	}
+
+	return &SQLiteRecorder{db: db, dedupWindowDays: dedupWindowDays, readOnly: true}, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %s", i+1, err)
+		}
+		// PRAGMA does not accept parameters.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %d of the SQLite database", i+1)
+	}
+	return nil
+}
+
+func (s *SQLiteRecorder) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteRecorder) SaveRecords(ctx context.Context, bookList *models.BookList) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("upload book records failed: %s", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO books (
+		ISBN, PubDate, Title, Url, Sources, Authors, Contributors, Publisher, Categories, Ccode,
+		Target, Format, Content, Ndc, NdcClass, NdcDivision, GenreCode, Price, Pages, Size,
+		TableOfContents, Description, Series, Volume, CoverUrl, CreatedAt, LastUpdatedAt, UploadedAt, UploadedDate
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("upload book records failed: %s", err)
+	}
+	defer stmt.Close()
+
+	for _, book := range bookList.Books {
+		r := convertIntoRecord(book, bookList.UploadDate)
+		sources, err := json.Marshal(r.Sources)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("cannot encode sources of %s: %s", r.ISBN, err)
+		}
+		contributors, err := json.Marshal(r.Contributors)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("cannot encode contributors of %s: %s", r.ISBN, err)
+		}
+		_, err = stmt.ExecContext(ctx,
+			r.ISBN, r.PubDate.String(), r.Title, r.Url, string(sources), r.Authors, string(contributors), r.Publisher, r.Categories, r.Ccode,
+			r.Target, r.Format, r.Content, r.Ndc, r.NdcClass, r.NdcDivision, r.GenreCode,
+			sql.NullInt64{Int64: r.Price.Int64, Valid: r.Price.Valid}, sql.NullInt64{Int64: r.Pages.Int64, Valid: r.Pages.Valid}, r.Size,
+			r.TableOfContents, r.Description, r.Series, r.Volume, r.CoverUrl,
+			nullSQLiteTimeIfZero(r.CreatedAt), nullSQLiteTimeIfZero(r.LastUpdatedAt), formatSQLiteTime(r.UploadedAt), r.UploadedDate.String(),
+		)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("upload book records failed: %s", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("upload book records failed: %s", err)
+	}
+	return nil
+}
+
+func (s *SQLiteRecorder) GetRecordedISBN(ctx context.Context, targetDate time.Time) ([]string, error) {
+
+	condition, args := sqliteDedupCondition(targetDate, s.dedupWindowDays)
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT ISBN FROM books WHERE `+condition, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+	defer rows.Close()
+
+	uploadedISBN := []string{}
+	for rows.Next() {
+		var isbn string
+		if err := rows.Scan(&isbn); err != nil {
+			log.Printf("Unexpected query results: %s", err)
+			continue
+		}
+		uploadedISBN = append(uploadedISBN, isbn)
+	}
+
+	return uploadedISBN, rows.Err()
+}
+
+// GetRecordedBooks returns the latest records of the books recorded in the dedup window, by ISBN.
+func (s *SQLiteRecorder) GetRecordedBooks(ctx context.Context, targetDate time.Time) (map[string]*models.RecordedBook, error) {
+
+	condition, args := sqliteDedupCondition(targetDate, s.dedupWindowDays)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT ISBN, Title, Publisher, Price, PubDate, UploadedDate FROM books WHERE `+condition+` ORDER BY UploadedAt`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+	defer rows.Close()
+
+	recordedBooks := make(map[string]*models.RecordedBook)
+	for rows.Next() {
+		var isbn, title, pubDate, uploadedDate string
+		var publisher sql.NullString
+		var price sql.NullInt64
+		if err := rows.Scan(&isbn, &title, &publisher, &price, &pubDate, &uploadedDate); err != nil {
+			log.Printf("Unexpected query results: %s", err)
+			continue
+		}
+		recordedBook := &models.RecordedBook{
+			Isbn:      isbn,
+			Title:     title,
+			Publisher: publisher.String,
+			Price:     int(price.Int64),
+		}
+		if d, err := civil.ParseDate(pubDate); err == nil {
+			recordedBook.PubDate = d.In(targetDate.Location())
+		}
+		if d, err := civil.ParseDate(uploadedDate); err == nil {
+			recordedBook.UploadedDate = d.In(targetDate.Location())
+		}
+		// Later rows overwrite the earlier ones of the same ISBN.
+		recordedBooks[isbn] = recordedBook
+	}
+
+	return recordedBooks, rows.Err()
+}
+
+// NotificationTracker tracks the deliveries to channel in table of the same database,
+// which is created when it does not exist unless the database is opened read-only.
+// The "notifications" table is created by the migrations.
+func (s *SQLiteRecorder) NotificationTracker(ctx context.Context, table string, channel string, retryWindow time.Duration) (*SQLiteNotificationTracker, error) {
+
+	if err := checkTrackingTable(table); err != nil {
+		return nil, err
+	}
+	if !s.readOnly {
+		_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+			ISBN TEXT NOT NULL,
+			Channel TEXT NOT NULL,
+			Status TEXT NOT NULL,
+			Message TEXT,
+			UpdatedAt TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS `+table+`_channel_updated_at ON `+table+` (Channel, UpdatedAt);`)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create the table %s: %s", table, err)
+		}
+	}
+
+	return &SQLiteNotificationTracker{db: s.db, table: table, channel: channel, retryWindow: retryWindow, now: time.Now}, nil
+}
+
+// SQLiteNotificationTracker is the SQLite counterpart of BQNotificationTracker.
+type SQLiteNotificationTracker struct {
+	db          *sql.DB
+	table       string
+	channel     string
+	retryWindow time.Duration
+	now         func() time.Time
+}
+
+// GetDeliveries returns the current deliveries to the channel within the retry window, by ISBN.
+func (t *SQLiteNotificationTracker) GetDeliveries(ctx context.Context) (map[string]*models.Delivery, error) {
+
+	rows, err := t.db.QueryContext(ctx,
+		`SELECT ISBN, Channel, Status, Message, UpdatedAt FROM `+t.table+` WHERE Channel = ? AND UpdatedAt >= ?`,
+		t.channel, formatSQLiteTime(t.now().Add(-t.retryWindow)))
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+	defer rows.Close()
+
+	var history []*models.Delivery
+	for rows.Next() {
+		var d models.Delivery
+		var status string
+		var message, updatedAt sql.NullString
+		if err := rows.Scan(&d.ISBN, &d.Channel, &status, &message, &updatedAt); err != nil {
+			log.Printf("Unexpected query results: %s", err)
+			continue
+		}
+		d.Status = models.DeliveryStatus(status)
+		d.Message = message.String
+		d.UpdatedAt = parseSQLiteTime(updatedAt)
+		history = append(history, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query execution failed: %s", err)
+	}
+
+	return models.LatestDeliveries(history), nil
+}
+
+// SaveDelivery appends the status of the delivery to the channel.
+func (t *SQLiteNotificationTracker) SaveDelivery(ctx context.Context, delivery *models.Delivery) error {
+	_, err := t.db.ExecContext(ctx,
+		`INSERT INTO `+t.table+` (ISBN, Channel, Status, Message, UpdatedAt) VALUES (?, ?, ?, ?, ?)`,
+		delivery.ISBN, t.channel, string(delivery.Status), delivery.Message, formatSQLiteTime(t.now()))
+	if err != nil {
+		return fmt.Errorf("saving delivery of %s failed: %s", delivery.ISBN, err)
+	}
+	return nil
+}
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// nullSQLiteTimeIfZero stores unknown times as NULL, as nullTimeIfZero does in PostgreSQL.
+func nullSQLiteTimeIfZero(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: formatSQLiteTime(t), Valid: true}
+}
+
+// parseSQLiteTime reads back a time stored by formatSQLiteTime, and NULL as the zero time.
+func parseSQLiteTime(s sql.NullString) time.Time {
+	if !s.Valid {
+		return time.Time{}
+	}
+	t, _ := time.Parse(sqliteTimeLayout, s.String)
+	return t
+}
+
+// sqliteDedupCondition limits the records to the dedup window up to targetDate, as queryBuilder.dedupCondition.
+func sqliteDedupCondition(targetDate time.Time, dedupWindowDays int) (string, []interface{}) {
+	to := civil.DateOf(targetDate).String()
+	if dedupWindowDays < 0 {
+		return "UploadedDate <= ?", []interface{}{to}
+	}
+	if dedupWindowDays <= 1 {
+		return "UploadedDate = ?", []interface{}{to}
+	}
+	from := civil.DateOf(targetDate.AddDate(0, 0, 1-dedupWindowDays)).String()
+	return "UploadedDate BETWEEN ? AND ?", []interface{}{from, to}
+}
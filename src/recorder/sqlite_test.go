@@ -0,0 +1,201 @@
+package recorder
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/new-books-notification/src/models"
+)
+
+func newTestSQLiteRecorder(t *testing.T, dedupWindowDays int) *SQLiteRecorder {
+	recorder, err := NewSQLiteRecorder(filepath.Join(t.TempDir(), "books.db"), dedupWindowDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close() })
+	return recorder
+}
+
+func TestSQLiteRecorderSavesAndGetsRecords(t *testing.T) {
+	recorder := newTestSQLiteRecorder(t, 7)
+	ctx := context.Background()
+
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	pubDate := time.Date(2024, time.September, 1, 0, 0, 0, 0, loc)
+	day1 := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	day2 := day1.AddDate(0, 0, 1)
+	day10 := day1.AddDate(0, 0, 9)
+
+	err := recorder.SaveRecords(ctx, &models.BookList{UploadDate: day1, Books: []*models.Book{
+		{
+			Isbn: "1111111111111", Title: "ご冗談でしょう、tatamiyaさん", PubDate: pubDate, Price: 2400, Publisher: "畳屋書店",
+			Sources:      []string{"hanmoto"},
+			Contributors: []models.Contributor{{Name: "tatamiya tamiya", Role: models.RoleAuthor}},
+		},
+	}})
+	assert.Nil(t, err)
+	err = recorder.SaveRecords(ctx, &models.BookList{UploadDate: day2, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "ご冗談でしょう、tatamiyaさん", PubDate: pubDate.AddDate(0, 1, 0)},
+		{Isbn: "2222222222222", Title: "流体力学（後編）", PubDate: pubDate},
+	}})
+	assert.Nil(t, err)
+
+	recordedISBN, err := recorder.GetRecordedISBN(ctx, day2)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"1111111111111", "2222222222222"}, recordedISBN)
+
+	recordedISBN, err = recorder.GetRecordedISBN(ctx, day10)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{}, recordedISBN)
+
+	recordedBooks, err := recorder.GetRecordedBooks(ctx, day2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(recordedBooks))
+	assert.Equal(t, "2024-10-01", recordedBooks["1111111111111"].PubDate.Format("2006-01-02"))
+	assert.Equal(t, "2024-08-02", recordedBooks["1111111111111"].UploadedDate.Format("2006-01-02"))
+	assert.Equal(t, 0, recordedBooks["1111111111111"].Price)
+}
+
+func TestSQLiteRecorderGetsRecordsOfTheDayOnly(t *testing.T) {
+	recorder := newTestSQLiteRecorder(t, 1)
+	ctx := context.Background()
+
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	day1 := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	err := recorder.SaveRecords(ctx, &models.BookList{UploadDate: day1, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "Book1", PubDate: day1},
+	}})
+	assert.Nil(t, err)
+
+	recordedISBN, err := recorder.GetRecordedISBN(ctx, day1.AddDate(0, 0, 1))
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{}, recordedISBN)
+}
+
+func TestSQLiteRecorderStoresUnknownTimesAsNull(t *testing.T) {
+	recorder := newTestSQLiteRecorder(t, 1)
+	ctx := context.Background()
+	day1 := time.Date(2024, time.August, 1, 22, 42, 0, 0, time.UTC)
+	created := time.Date(2024, time.July, 1, 9, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, recorder.SaveRecords(ctx, &models.BookList{UploadDate: day1, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "Book1", PubDate: day1, CreatedDate: created},
+	}}))
+
+	var createdAt, lastUpdatedAt sql.NullString
+	err := recorder.db.QueryRowContext(ctx, `SELECT CreatedAt, LastUpdatedAt FROM books WHERE ISBN = ?`, "1111111111111").Scan(&createdAt, &lastUpdatedAt)
+	assert.Nil(t, err)
+	assert.True(t, createdAt.Valid)
+	assert.False(t, lastUpdatedAt.Valid)
+	assert.True(t, created.Equal(parseSQLiteTime(createdAt)))
+	assert.True(t, parseSQLiteTime(lastUpdatedAt).IsZero())
+}
+
+func TestSQLiteRecorderMigratesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	for i := 0; i < 2; i++ {
+		recorder, err := NewSQLiteRecorder(path, 1)
+		assert.Nil(t, err)
+
+		var version int
+		assert.Nil(t, recorder.db.QueryRow(`PRAGMA user_version`).Scan(&version))
+		assert.Equal(t, len(sqliteMigrations), version)
+		recorder.Close()
+	}
+}
+
+func TestReadOnlySQLiteRecorderLooksUpWithoutWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	_, err := NewReadOnlySQLiteRecorder(path, 1)
+	assert.NotNil(t, err)
+	assert.NoFileExists(t, path)
+
+	recorder, err := NewSQLiteRecorder(path, 1)
+	assert.Nil(t, err)
+	ctx := context.Background()
+	day1 := time.Date(2024, time.August, 1, 22, 42, 0, 0, time.UTC)
+	assert.Nil(t, recorder.SaveRecords(ctx, &models.BookList{UploadDate: day1, Books: []*models.Book{
+		{Isbn: "1111111111111", Title: "Book1", PubDate: day1},
+	}}))
+	recorder.Close()
+
+	readOnlyRecorder, err := NewReadOnlySQLiteRecorder(path, 1)
+	assert.Nil(t, err)
+	defer readOnlyRecorder.Close()
+	recordedISBN, err := readOnlyRecorder.GetRecordedISBN(ctx, day1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"1111111111111"}, recordedISBN)
+	assert.NotNil(t, readOnlyRecorder.SaveRecords(ctx, &models.BookList{UploadDate: day1, Books: []*models.Book{
+		{Isbn: "2222222222222", Title: "Book2", PubDate: day1},
+	}}))
+}
+
+func TestSQLiteNotificationTrackerUsesConfiguredTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	recorder, err := NewSQLiteRecorder(path, 1)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = recorder.NotificationTracker(ctx, "deliveries; DROP TABLE books", "slack", 24*time.Hour)
+	assert.NotNil(t, err)
+
+	tracker, err := recorder.NotificationTracker(ctx, "my_deliveries", "slack", 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Nil(t, tracker.SaveDelivery(ctx, &models.Delivery{ISBN: "1111111111111", Status: models.DeliverySent}))
+
+	var count int
+	assert.Nil(t, recorder.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM my_deliveries`).Scan(&count))
+	assert.Equal(t, 1, count)
+	assert.Nil(t, recorder.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications`).Scan(&count))
+	assert.Equal(t, 0, count)
+	recorder.Close()
+
+	// The read-only database is looked up without creating the table.
+	readOnlyRecorder, err := NewReadOnlySQLiteRecorder(path, 1)
+	assert.Nil(t, err)
+	defer readOnlyRecorder.Close()
+	readOnlyTracker, err := readOnlyRecorder.NotificationTracker(ctx, "my_deliveries", "slack", 24*time.Hour)
+	assert.Nil(t, err)
+	deliveries, err := readOnlyTracker.GetDeliveries(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, models.DeliverySent, deliveries["1111111111111"].Status)
+	missingTracker, err := readOnlyRecorder.NotificationTracker(ctx, "missing_deliveries", "slack", 24*time.Hour)
+	assert.Nil(t, err)
+	_, err = missingTracker.GetDeliveries(ctx)
+	assert.NotNil(t, err)
+}
+
+func TestSQLiteNotificationTracker(t *testing.T) {
+	recorder := newTestSQLiteRecorder(t, 1)
+	ctx := context.Background()
+	now := time.Date(2024, time.August, 1, 22, 42, 0, 0, time.UTC)
+
+	tracker, err := recorder.NotificationTracker(ctx, "notifications", "slack", 24*time.Hour)
+	assert.Nil(t, err)
+	tracker.now = func() time.Time { return now }
+	assert.Nil(t, tracker.SaveDelivery(ctx, &models.Delivery{ISBN: "1111111111111", Status: models.DeliveryPending, Message: "book1"}))
+	assert.Nil(t, tracker.SaveDelivery(ctx, &models.Delivery{ISBN: "2222222222222", Status: models.DeliveryPending, Message: "book2"}))
+	now = now.Add(time.Second)
+	assert.Nil(t, tracker.SaveDelivery(ctx, &models.Delivery{ISBN: "1111111111111", Status: models.DeliverySent, Message: "book1"}))
+
+	other, err := recorder.NotificationTracker(ctx, "notifications", "email", 24*time.Hour)
+	assert.Nil(t, err)
+	other.now = tracker.now
+	assert.Nil(t, other.SaveDelivery(ctx, &models.Delivery{ISBN: "3333333333333", Status: models.DeliveryFailed}))
+
+	deliveries, err := tracker.GetDeliveries(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(deliveries))
+	assert.Equal(t, models.DeliverySent, deliveries["1111111111111"].Status)
+	assert.Equal(t, models.DeliveryPending, deliveries["2222222222222"].Status)
+	assert.Equal(t, "book2", deliveries["2222222222222"].Message)
+
+	now = now.Add(48 * time.Hour)
+	deliveries, err = tracker.GetDeliveries(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, deliveries)
+}
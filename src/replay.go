@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/tatamiya/new-books-notification/src/models"
+	"github.com/tatamiya/new-books-notification/src/uploader"
+)
+
+// archiveReader reads back the feeds uploaded by generateJsonUploadObject.
+type archiveReader interface {
+	Download(string) ([]byte, error)
+}
+
+// runReplay runs the pipeline against archived feeds, e.g. "replay -dry-run feed20240801.json".
+func runReplay(args []string) int {
+
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	directory := flags.String("dir", "", "local directory of the archived feeds, read instead of the configured archive")
+	dryRun := flags.Bool("dry-run", false, "print what would be notified and recorded instead of doing it")
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		log.Printf("Error in loading config: %s", err)
+		return exitSetupFailed
+	}
+	if !*dryRun {
+		if err := cfg.ValidateRecorder(); err != nil {
+			log.Printf("Error in loading config: %s", err)
+			return exitSetupFailed
+		}
+	}
+	if *directory == "" {
+		if err := cfg.ValidateArchive(); err != nil {
+			log.Printf("Error in loading config: %s", err)
+			return exitSetupFailed
+		}
+	}
+
+	objectNames := flags.Args()
+	if len(objectNames) == 0 {
+		log.Println("Specify the archived feeds to replay.")
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	var archive archiveReader
+	if *directory != "" {
+		localArchive, err := uploader.NewLocalUploader(*directory, 0)
+		if err != nil {
+			log.Printf("Error in opening the local archive: %s", err)
+			return exitSetupFailed
+		}
+		archive = localArchive
+	} else {
+		feedArchive, err := newFeedArchive(ctx, cfg)
+		if err != nil {
+			log.Printf("Error in connecting to the feed archive: %s", err)
+			return exitSetupFailed
+		}
+		archive = feedArchive
+	}
+
+	bookList, err := loadArchivedBookList(archive, objectNames, cfg.Feeds[0].Name)
+	if err != nil {
+		log.Printf("Could not load archived feed!: %s", err)
+		return exitSetupFailed
+	}
+	log.Println(bookList.UploadDate.String())
+
+	p, err := newPipeline(ctx, cfg, *dryRun, true)
+	if err != nil {
+		log.Println(err)
+		return exitSetupFailed
+	}
+	defer p.close()
+
+	result := coreProcess(bookList, p.fetcher, p.recorder, p.filter, p.notifier, p.tracker, p.notifyUpdates, p.maxConcurrency)
+	log.Printf("Replayed %s", result)
+	p.writeDryRunReport(os.Stdout)
+
+	return result.ExitCode(cfg.FailureThresholds.Recording, cfg.FailureThresholds.Notification)
+}
+
+// loadArchivedBookList rebuilds the feeds from the archived objects and merges their books into one list.
+// Objects named without a source are attributed to defaultSourceName.
+func loadArchivedBookList(archive archiveReader, objectNames []string, defaultSourceName string) (*models.BookList, error) {
+
+	var bookLists []*models.BookList
+	for _, objectName := range objectNames {
+		binary, err := archive.Download(objectName)
+		if err != nil {
+			return nil, err
+		}
+
+		var feed gofeed.Feed
+		if err := json.Unmarshal(binary, &feed); err != nil {
+			return nil, fmt.Errorf("cannot parse archived feed %s: %s", objectName, err)
+		}
+		if feed.PublishedParsed == nil {
+			return nil, fmt.Errorf("archived feed %s has no published date", objectName)
+		}
+		for _, item := range feed.Items {
+			if item.PublishedParsed == nil {
+				return nil, fmt.Errorf("item %s of archived feed %s has no published date", item.Link, objectName)
+			}
+		}
+
+		bookList := models.NewBookListFromFeed(&feed)
+		bookList.TagSource(archivedSourceName(objectName, defaultSourceName))
+		bookLists = append(bookLists, bookList)
+	}
+
+	return models.MergeBookLists(bookLists...), nil
+}
+
+// archivedSourceName recovers the source name from the object name given by generateJsonUploadObject.
+func archivedSourceName(objectName string, defaultSourceName string) string {
+	name := strings.TrimSuffix(filepath.Base(objectName), ".json")
+	if i := strings.Index(name, "_"); i >= 0 {
+		return name[i+1:]
+	}
+	return defaultSourceName
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/new-books-notification/src/uploader"
+)
+
+func TestLoadArchivedBookListRestoresUploadedFeeds(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	datePublished := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+	dateItem := time.Date(2024, time.August, 31, 12, 13, 24, 0, loc)
+	archiveDir := t.TempDir()
+
+	for _, testFeed := range []struct {
+		sourceName string
+		isbn       string
+	}{
+		{sourceName: "", isbn: "1111111111111"},
+		{sourceName: "genre", isbn: "2222222222222"},
+	} {
+		inputFeed := gofeed.Feed{
+			PublishedParsed: &datePublished,
+			Items: []*gofeed.Item{
+				{
+					Title:           "Book " + testFeed.isbn,
+					Link:            "http://example.com/bd/isbn/" + testFeed.isbn,
+					PublishedParsed: &dateItem,
+				},
+			},
+		}
+		uploadObject, err := generateJsonUploadObject(&inputFeed, testFeed.sourceName, uploader.DefaultPathTemplate)
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(archiveDir, uploadObject.ObjectName), uploadObject.Binary, 0644))
+	}
+
+	localArchive, err := uploader.NewLocalUploader(archiveDir, 0)
+	assert.Nil(t, err)
+	actualBookList, err := loadArchivedBookList(
+		localArchive,
+		[]string{"feed20240801.json", "feed20240801_genre.json"},
+		"hanmoto",
+	)
+
+	assert.Nil(t, err)
+	assert.True(t, datePublished.Equal(actualBookList.UploadDate))
+	assert.Equal(t, 2, len(actualBookList.Books))
+	assert.Equal(t, "1111111111111", actualBookList.Books[0].Isbn)
+	assert.EqualValues(t, []string{"hanmoto"}, actualBookList.Books[0].Sources)
+	assert.Equal(t, "2222222222222", actualBookList.Books[1].Isbn)
+	assert.EqualValues(t, []string{"genre"}, actualBookList.Books[1].Sources)
+	assert.True(t, dateItem.Equal(actualBookList.Books[1].PubDate))
+}
+
+func TestLoadArchivedBookListFailsWithMissingObject(t *testing.T) {
+	localArchive, err := uploader.NewLocalUploader(t.TempDir(), 0)
+	assert.Nil(t, err)
+	_, err = loadArchivedBookList(localArchive, []string{"feed20240801.json"}, "hanmoto")
+
+	assert.NotNil(t, err)
+}
+
+func TestArchivedSourceNameOfCustomPathTemplate(t *testing.T) {
+	assert.Equal(t, "genre", archivedSourceName("new_books/2024/08/feed-20240801_genre.json", "hanmoto"))
+	assert.Equal(t, "hanmoto", archivedSourceName("new_books/2024/08/feed-20240801.json", "hanmoto"))
+}
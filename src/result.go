@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/tatamiya/new-books-notification/src/models"
+)
+
+// Exit codes of the commands. A job failing in recording exits with exitRecordingFailed
+// even if notification also failed, since lost records cannot be recovered by the next run.
+const (
+	exitOK                 = 0
+	exitSetupFailed        = 1
+	exitUsage              = 2
+	exitNotificationFailed = 3
+	exitRecordingFailed    = 4
+)
+
+type StageResult struct {
+	Succeeded int
+	Failed    int
+}
+
+func (s StageResult) failureRatio() float64 {
+	total := s.Succeeded + s.Failed
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(total)
+}
+
+func (s StageResult) add(other StageResult) StageResult {
+	return StageResult{Succeeded: s.Succeeded + other.Succeeded, Failed: s.Failed + other.Failed}
+}
+
+// RunResult counts the outcomes of each stage of coreProcess.
+// Books with no record in OpenBD are counted in EmptyDetails rather than as failures.
+type RunResult struct {
+	NewBooks     int
+	UpdatedBooks int
+	Lookup       StageResult
+	Details      StageResult
+	EmptyDetails int
+	Notification StageResult
+	Recording    StageResult
+
+	// Favorite books skipped since they were notified by a previous run,
+	// and the loads and saves of the deliveries in the notification tracker.
+	AlreadyNotified int
+	Tracking        StageResult
+
+	// ProcessedBooks are the books recorded by the run, with their details, to be archived.
+	// They are not summed up by Add.
+	ProcessedBooks *models.BookList
+
+	mu sync.Mutex
+}
+
+func (r *RunResult) count(stage *StageResult, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		stage.Failed++
+	} else {
+		stage.Succeeded++
+	}
+}
+
+func (r *RunResult) increment(counter *int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*counter++
+}
+
+// Add sums up the results, e.g. of the days of a backfill.
+func (r *RunResult) Add(other *RunResult) {
+	r.NewBooks += other.NewBooks
+	r.UpdatedBooks += other.UpdatedBooks
+	r.Lookup = r.Lookup.add(other.Lookup)
+	r.Details = r.Details.add(other.Details)
+	r.EmptyDetails += other.EmptyDetails
+	r.Notification = r.Notification.add(other.Notification)
+	r.Recording = r.Recording.add(other.Recording)
+	r.AlreadyNotified += other.AlreadyNotified
+	r.Tracking = r.Tracking.add(other.Tracking)
+}
+
+func (r *RunResult) String() string {
+	return fmt.Sprintf(
+		"%d new book(s), %d updated; lookup of records: %d failed; details: %d fetched, %d empty, %d failed; "+
+			"notification: %d sent, %d failed, %d already sent; tracking: %d failed; recording: %d saved, %d failed",
+		r.NewBooks, r.UpdatedBooks, r.Lookup.Failed,
+		r.Details.Succeeded, r.EmptyDetails, r.Details.Failed,
+		r.Notification.Succeeded, r.Notification.Failed, r.AlreadyNotified, r.Tracking.Failed,
+		r.Recording.Succeeded, r.Recording.Failed,
+	)
+}
+
+// ExitCode judges the run as failed when the ratio of failures in recording or notification exceeds its threshold.
+// A failed lookup of the records is regarded as a failure of recording, since it may record the books twice.
+func (r *RunResult) ExitCode(recordingThreshold float64, notificationThreshold float64) int {
+	if r.Lookup.Failed > 0 || r.Recording.failureRatio() > recordingThreshold {
+		return exitRecordingFailed
+	}
+	if r.Notification.failureRatio() > notificationThreshold {
+		return exitNotificationFailed
+	}
+	return exitOK
+}
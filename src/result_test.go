@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunResultExitCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		result   *RunResult
+		expected int
+	}{
+		{
+			name: "all succeeded",
+			result: &RunResult{
+				Notification: StageResult{Succeeded: 2},
+				Recording:    StageResult{Succeeded: 5},
+			},
+			expected: exitOK,
+		},
+		{
+			name:     "nothing processed",
+			result:   &RunResult{},
+			expected: exitOK,
+		},
+		{
+			name: "notification failures within threshold",
+			result: &RunResult{
+				Notification: StageResult{Succeeded: 9, Failed: 1},
+				Recording:    StageResult{Succeeded: 10},
+			},
+			expected: exitOK,
+		},
+		{
+			name: "notification failures past threshold",
+			result: &RunResult{
+				Notification: StageResult{Succeeded: 1, Failed: 1},
+				Recording:    StageResult{Succeeded: 10},
+			},
+			expected: exitNotificationFailed,
+		},
+		{
+			name: "recording failed",
+			result: &RunResult{
+				Notification: StageResult{Failed: 2},
+				Recording:    StageResult{Failed: 10},
+			},
+			expected: exitRecordingFailed,
+		},
+		{
+			name: "lookup failed",
+			result: &RunResult{
+				Lookup:    StageResult{Failed: 1},
+				Recording: StageResult{Succeeded: 10},
+			},
+			expected: exitRecordingFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.result.ExitCode(0, 0.1))
+		})
+	}
+}
+
+func TestRunResultAdd(t *testing.T) {
+	total := &RunResult{}
+	total.Add(&RunResult{NewBooks: 2, EmptyDetails: 1, Recording: StageResult{Succeeded: 2}})
+	total.Add(&RunResult{NewBooks: 3, Notification: StageResult{Failed: 1}, Recording: StageResult{Failed: 3}})
+
+	assert.Equal(t, 5, total.NewBooks)
+	assert.Equal(t, 1, total.EmptyDetails)
+	assert.Equal(t, StageResult{Succeeded: 0, Failed: 1}, total.Notification)
+	assert.Equal(t, StageResult{Succeeded: 2, Failed: 3}, total.Recording)
+}
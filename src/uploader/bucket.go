@@ -2,46 +2,120 @@ package uploader
 
 import (
 	"context"
+	"crypto/md5"
+	"errors"
 	"fmt"
-	"path/filepath"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"path"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
 )
 
+// ErrObjectExists is reported by the uploaders which do not overwrite, when the object is archived already,
+// e.g. the feed of the day on a re-run.
+var ErrObjectExists = errors.New("the object already exists")
+
 type UploadObject struct {
 	ObjectName  string
 	ContentType string
 	Binary      []byte
 }
 
+// GCSSettings locates the objects in a bucket and tells how they are written.
+// Checksum is "md5" or "crc32c" to have GCS verify the content of the uploaded objects, or empty not to.
+// With NoOverwrite, the upload of an object which already exists fails with ErrObjectExists instead of replacing it.
+type GCSSettings struct {
+	BucketName  string
+	Directory   string
+	Checksum    string
+	NoOverwrite bool
+}
+
 type GCSUploader struct {
-	bucket    *storage.BucketHandle
-	directory string
+	bucket      *storage.BucketHandle
+	directory   string
+	checksum    string
+	noOverwrite bool
 }
 
-func NewGCSUploader(ctx context.Context, bucketName string, directory string) (*GCSUploader, error) {
+func NewGCSUploader(ctx context.Context, settings *GCSSettings, opts ...option.ClientOption) (*GCSUploader, error) {
 
-	client, err := storage.NewClient(ctx)
+	switch settings.Checksum {
+	case "", "md5", "crc32c":
+	default:
+		return nil, fmt.Errorf("Unknown checksum %q", settings.Checksum)
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("Cannot connect to GCS: %s", err)
 	}
 
 	return &GCSUploader{
-		bucket:    client.Bucket(bucketName),
-		directory: directory,
+		bucket:      client.Bucket(settings.BucketName),
+		directory:   settings.Directory,
+		checksum:    settings.Checksum,
+		noOverwrite: settings.NoOverwrite,
 	}, nil
 }
 
 func (b *GCSUploader) Upload(object *UploadObject) error {
-	objectPath := filepath.Join(b.directory, object.ObjectName)
-	ctx := context.Background()
-	w := b.bucket.Object(objectPath).NewWriter(ctx)
+	objectPath := path.Join(b.directory, object.ObjectName)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	objectHandle := b.bucket.Object(objectPath)
+	if b.noOverwrite {
+		// Same as ifGenerationMatch=0.
+		objectHandle = objectHandle.If(storage.Conditions{DoesNotExist: true})
+	}
+	w := objectHandle.NewWriter(ctx)
 	w.ContentType = object.ContentType
-	_, err := w.Write(object.Binary)
-	if err != nil {
+	switch b.checksum {
+	case "md5":
+		sum := md5.Sum(object.Binary)
+		w.MD5 = sum[:]
+	case "crc32c":
+		w.CRC32C = crc32.Checksum(object.Binary, crc32.MakeTable(crc32.Castagnoli))
+		w.SendCRC32C = true
+	}
+
+	if _, err := w.Write(object.Binary); err != nil {
+		// Canceling the context aborts the upload, so that nothing is committed by Close.
+		cancel()
+		w.Close()
+		return fmt.Errorf("Cannot upload %s to GCS: %s", object.ObjectName, err)
+	}
+	// The object is committed on Close, which reports most of the failures.
+	if err := w.Close(); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			return fmt.Errorf("Cannot upload %s to GCS: %w", object.ObjectName, ErrObjectExists)
+		}
 		return fmt.Errorf("Cannot upload %s to GCS: %s", object.ObjectName, err)
 	}
-	defer w.Close()
 
 	return nil
 }
+
+// Download reads back an object uploaded under the directory, e.g. an archived feed.
+func (b *GCSUploader) Download(objectName string) ([]byte, error) {
+	objectPath := path.Join(b.directory, objectName)
+	ctx := context.Background()
+	r, err := b.bucket.Object(objectPath).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot download %s from GCS: %s", objectName, err)
+	}
+	defer r.Close()
+
+	binary, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read %s from GCS: %s", objectName, err)
+	}
+
+	return binary, nil
+}
@@ -0,0 +1,161 @@
+package uploader
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+// gcsServerStub keeps the objects of multipart uploads to the JSON API, and verifies their checksums
+// and the ifGenerationMatch precondition as GCS does.
+type gcsServerStub struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+}
+
+func newGCSServerStub() *gcsServerStub {
+	return &gcsServerStub{objects: map[string][]byte{}, metadata: map[string]map[string]string{}}
+}
+
+func (s *gcsServerStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPost || r.URL.Path != "/upload/storage/v1/b/feeds/o" {
+		writeGCSError(w, http.StatusNotFound, "not found")
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if _, exists := s.objects[name]; exists && r.URL.Query().Get("ifGenerationMatch") == "0" {
+		writeGCSError(w, http.StatusPreconditionFailed, "conditionNotMet")
+		return
+	}
+
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	parts := multipart.NewReader(r.Body, params["boundary"])
+	part, _ := parts.NextPart()
+	metadata := map[string]string{}
+	json.NewDecoder(part).Decode(&metadata)
+	part, _ = parts.NextPart()
+	content, _ := ioutil.ReadAll(part)
+
+	md5Sum := md5.Sum(content)
+	if metadata["md5Hash"] != "" && metadata["md5Hash"] != base64.StdEncoding.EncodeToString(md5Sum[:]) {
+		writeGCSError(w, http.StatusBadRequest, "md5 mismatch")
+		return
+	}
+	crc32cSum := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc32cSum, crc32.Checksum(content, crc32.MakeTable(crc32.Castagnoli)))
+	if metadata["crc32c"] != "" && metadata["crc32c"] != base64.StdEncoding.EncodeToString(crc32cSum) {
+		writeGCSError(w, http.StatusBadRequest, "crc32c mismatch")
+		return
+	}
+
+	s.objects[name] = content
+	s.metadata[name] = metadata
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"bucket": "feeds", "name": %q, "generation": "1"}`, name)
+}
+
+func writeGCSError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": %q}}`, code, message)
+}
+
+func newTestGCSUploader(t *testing.T, handler http.Handler, settings GCSSettings) *GCSUploader {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	settings.BucketName = "feeds"
+	gcsUploader, err := NewGCSUploader(context.Background(), &settings,
+		option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gcsUploader
+}
+
+func TestGCSUploaderSendsChecksums(t *testing.T) {
+	for _, checksum := range []string{"", "md5", "crc32c"} {
+		stub := newGCSServerStub()
+		gcsUploader := newTestGCSUploader(t, stub, GCSSettings{Directory: "archive", Checksum: checksum})
+
+		err := gcsUploader.Upload(&UploadObject{ObjectName: "2024/08/feed20240801.json", ContentType: "application/json", Binary: []byte("{}")})
+
+		assert.Nil(t, err, checksum)
+		assert.Equal(t, []byte("{}"), stub.objects["archive/2024/08/feed20240801.json"], checksum)
+		assert.Equal(t, checksum == "md5", stub.metadata["archive/2024/08/feed20240801.json"]["md5Hash"] != "", checksum)
+		assert.Equal(t, checksum == "crc32c", stub.metadata["archive/2024/08/feed20240801.json"]["crc32c"] != "", checksum)
+	}
+}
+
+func TestGCSUploaderReportsFailedCommit(t *testing.T) {
+	forbidden := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeGCSError(w, http.StatusForbidden, "forbidden")
+	})
+	gcsUploader := newTestGCSUploader(t, forbidden, GCSSettings{})
+
+	err := gcsUploader.Upload(&UploadObject{ObjectName: "feed20240801.json", Binary: []byte("{}")})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "forbidden")
+}
+
+func TestGCSUploaderDoesNotOverwrite(t *testing.T) {
+	stub := newGCSServerStub()
+	stub.objects["feed20240801.json"] = []byte("{}")
+
+	overwritingUploader := newTestGCSUploader(t, stub, GCSSettings{})
+	assert.Nil(t, overwritingUploader.Upload(&UploadObject{ObjectName: "feed20240801.json", Binary: []byte(`{"title":"feed"}`)}))
+	assert.Equal(t, []byte(`{"title":"feed"}`), stub.objects["feed20240801.json"])
+
+	gcsUploader := newTestGCSUploader(t, stub, GCSSettings{NoOverwrite: true})
+	err := gcsUploader.Upload(&UploadObject{ObjectName: "feed20240801.json", Binary: []byte("{}")})
+	assert.True(t, errors.Is(err, ErrObjectExists))
+	assert.Contains(t, err.Error(), "already exists")
+	assert.Equal(t, []byte(`{"title":"feed"}`), stub.objects["feed20240801.json"])
+
+	assert.Nil(t, gcsUploader.Upload(&UploadObject{ObjectName: "feed20240802.json", Binary: []byte("{}")}))
+}
+
+func TestGCSUploaderReportsExistingObjectsOnRerun(t *testing.T) {
+	stub := newGCSServerStub()
+	gcsUploader := newTestGCSUploader(t, stub, GCSSettings{NoOverwrite: true})
+
+	for _, objectName := range []string{"feed20240801.json", "feed20240801.run-20240801T224200.manifest.json"} {
+		assert.Nil(t, gcsUploader.Upload(&UploadObject{ObjectName: objectName, Binary: []byte("{}")}))
+	}
+
+	// The feed of the day exists already, while the objects of the run are new.
+	err := gcsUploader.Upload(&UploadObject{ObjectName: "feed20240801.json", Binary: []byte("{}")})
+	assert.True(t, errors.Is(err, ErrObjectExists))
+	assert.Nil(t, gcsUploader.Upload(&UploadObject{ObjectName: "feed20240801.run-20240801T234200.manifest.json", Binary: []byte("{}")}))
+
+	forbidden := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeGCSError(w, http.StatusForbidden, "forbidden")
+	})
+	err = newTestGCSUploader(t, forbidden, GCSSettings{NoOverwrite: true}).Upload(&UploadObject{ObjectName: "feed20240801.json", Binary: []byte("{}")})
+	assert.False(t, errors.Is(err, ErrObjectExists))
+}
+
+func TestNewGCSUploaderRejectsUnknownChecksum(t *testing.T) {
+	_, err := NewGCSUploader(context.Background(), &GCSSettings{BucketName: "feeds", Checksum: "sha1"}, option.WithoutAuthentication())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,171 @@
+package uploader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalUploader archives the objects as files under a local directory, for deployments without a bucket.
+// Object names may contain slashes, which are made into subdirectories.
+// When maxRuns is positive, the files of the oldest runs are removed so that the directory keeps the latest maxRuns runs.
+type LocalUploader struct {
+	directory string
+	maxRuns   int
+}
+
+func NewLocalUploader(directory string, maxRuns int) (*LocalUploader, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, fmt.Errorf("Cannot create archive directory %s: %s", directory, err)
+	}
+	return &LocalUploader{directory: directory, maxRuns: maxRuns}, nil
+}
+
+func (l *LocalUploader) Upload(object *UploadObject) error {
+	objectPath := filepath.Join(l.directory, filepath.FromSlash(object.ObjectName))
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return fmt.Errorf("Cannot save %s: %s", object.ObjectName, err)
+	}
+
+	// Written to a temporary file first so that an interrupted upload does not leave a partial object.
+	tmp, err := ioutil.TempFile(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("Cannot save %s: %s", object.ObjectName, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(object.Binary); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Cannot save %s: %s", object.ObjectName, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Cannot save %s: %s", object.ObjectName, err)
+	}
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		return fmt.Errorf("Cannot save %s: %s", object.ObjectName, err)
+	}
+
+	// Rotated once the run is complete, so that a run being archived is never removed in part.
+	if l.maxRuns > 0 && strings.HasSuffix(object.ObjectName, ManifestSuffix) {
+		if err := l.rotate(); err != nil {
+			log.Printf("Cannot rotate archive directory %s: %s", l.directory, err)
+		}
+	}
+	return nil
+}
+
+// archivedRun is a manifest with the files named after it, e.g. "feed20240801.run-20240801T224200.books.csv"
+// of "feed20240801.run-20240801T224200.manifest.json", with the feeds such as "feed20240801.json" and "feed20240801_genre.json"
+// if it is the latest run of the day, or a file without a manifest archived before the manifests were introduced.
+type archivedRun struct {
+	paths   []string
+	modTime int64
+}
+
+// rotate removes the files of the least recently modified runs beyond maxRuns.
+// The manifest of a run is removed last, so that a run removed in part is removed again by the next rotation.
+func (l *LocalUploader) rotate() error {
+
+	type archivedFile struct {
+		path    string
+		modTime int64
+	}
+	var files []archivedFile
+	var prefixes []string
+	err := filepath.Walk(l.directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		files = append(files, archivedFile{path: path, modTime: info.ModTime().UnixNano()})
+		if strings.HasSuffix(path, ManifestSuffix) {
+			prefixes = append(prefixes, strings.TrimSuffix(path, ManifestSuffix))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	runs := make(map[string]*archivedRun)
+	for _, file := range files {
+		prefix := runPrefix(file.path, prefixes)
+		run, ok := runs[prefix]
+		if !ok {
+			run = &archivedRun{}
+			runs[prefix] = run
+		}
+		// The manifest is sorted last.
+		if strings.HasSuffix(file.path, ManifestSuffix) {
+			run.paths = append(run.paths, file.path)
+		} else {
+			run.paths = append([]string{file.path}, run.paths...)
+		}
+		if file.modTime > run.modTime {
+			run.modTime = file.modTime
+		}
+	}
+	if len(runs) <= l.maxRuns {
+		return nil
+	}
+
+	var sortedRuns []*archivedRun
+	for _, run := range runs {
+		sortedRuns = append(sortedRuns, run)
+	}
+	sort.Slice(sortedRuns, func(i, j int) bool {
+		if sortedRuns[i].modTime == sortedRuns[j].modTime {
+			return sortedRuns[i].paths[0] < sortedRuns[j].paths[0]
+		}
+		return sortedRuns[i].modTime < sortedRuns[j].modTime
+	})
+	for _, run := range sortedRuns[:len(sortedRuns)-l.maxRuns] {
+		for _, path := range run.paths {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			log.Printf("Removed archived %s", path)
+		}
+	}
+	return nil
+}
+
+// runPrefix returns the manifest prefix of the run to which the file at path belongs,
+// or the path itself for a file without a manifest.
+// The feeds, which are shared by the runs of the day, belong to the latest run.
+func runPrefix(path string, prefixes []string) string {
+	longest := ""
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix+".") && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	if longest != "" {
+		return longest
+	}
+	latest := ""
+	for _, prefix := range prefixes {
+		feed := feedPrefix(prefix)
+		if (strings.HasPrefix(path, feed+".") || strings.HasPrefix(path, feed+"_")) && prefix > latest {
+			latest = prefix
+		}
+	}
+	if latest != "" {
+		return latest
+	}
+	return path
+}
+
+// Download reads back an object uploaded under the directory, e.g. an archived feed.
+func (l *LocalUploader) Download(objectName string) ([]byte, error) {
+	binary, err := ioutil.ReadFile(filepath.Join(l.directory, filepath.FromSlash(objectName)))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read %s: %s", objectName, err)
+	}
+	return binary, nil
+}
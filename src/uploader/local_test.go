@@ -0,0 +1,75 @@
+package uploader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalUploaderUploadsAndDownloads(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "archive")
+	localUploader, err := NewLocalUploader(directory, 0)
+	assert.Nil(t, err)
+
+	err = localUploader.Upload(&UploadObject{ObjectName: "2024/08/feed20240801.json", ContentType: "application/json", Binary: []byte("{}")})
+	assert.Nil(t, err)
+
+	binary, err := localUploader.Download("2024/08/feed20240801.json")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("{}"), binary)
+
+	_, err = localUploader.Download("feed20240802.json")
+	assert.NotNil(t, err)
+}
+
+func TestLocalUploaderRemovesOldestRuns(t *testing.T) {
+	directory := t.TempDir()
+	localUploader, err := NewLocalUploader(directory, 2)
+	assert.Nil(t, err)
+
+	// A feed archived before the manifests were introduced is a run by itself.
+	assert.Nil(t, localUploader.Upload(&UploadObject{ObjectName: "feed20240731.json", Binary: []byte("{}")}))
+	modTime := time.Date(2024, time.July, 31, 0, 0, 0, 0, time.UTC)
+	assert.Nil(t, os.Chtimes(filepath.Join(directory, "feed20240731.json"), modTime, modTime))
+
+	// A run archived before the run time was added to the names.
+	modTime = modTime.AddDate(0, 0, 1)
+	for _, objectName := range []string{"feed20240801_hanmoto.json", "feed20240801.books.jsonl", "feed20240801.books.csv", "feed20240801" + ManifestSuffix} {
+		assert.Nil(t, localUploader.Upload(&UploadObject{ObjectName: objectName, Binary: []byte("{}")}))
+		assert.Nil(t, os.Chtimes(filepath.Join(directory, objectName), modTime, modTime))
+	}
+	// Two runs of 20240802, which share the feed, and a run of 20240803.
+	for _, runAt := range []time.Time{
+		time.Date(2024, time.August, 2, 22, 42, 0, 0, time.UTC),
+		time.Date(2024, time.August, 2, 23, 42, 0, 0, time.UTC),
+		time.Date(2024, time.August, 3, 22, 42, 0, 0, time.UTC),
+	} {
+		modTime = runAt
+		feedName := "feed" + runAt.Format("20060102") + "_hanmoto.json"
+		prefix := RunPrefix("feed"+runAt.Format("20060102")+".json", runAt)
+		for _, objectName := range []string{feedName, prefix + ".books.jsonl", prefix + ".books.csv", prefix + ManifestSuffix} {
+			assert.Nil(t, localUploader.Upload(&UploadObject{ObjectName: objectName, Binary: []byte("{}")}))
+			assert.Nil(t, os.Chtimes(filepath.Join(directory, objectName), modTime, modTime))
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(directory, "*"))
+	assert.Nil(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	assert.Equal(t, []string{
+		"feed20240802.run-20240802T234200.books.csv",
+		"feed20240802.run-20240802T234200.books.jsonl",
+		"feed20240802.run-20240802T234200.manifest.json",
+		"feed20240802_hanmoto.json",
+		"feed20240803.run-20240803T224200.books.csv",
+		"feed20240803.run-20240803T224200.books.jsonl",
+		"feed20240803.run-20240803T224200.manifest.json",
+		"feed20240803_hanmoto.json",
+	}, names)
+}
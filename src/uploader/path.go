@@ -0,0 +1,69 @@
+package uploader
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultPathTemplate names the objects flat, as before the path template was introduced.
+const DefaultPathTemplate = "feed{yyyymmdd}.json"
+
+// ManifestSuffix is added to the run prefix to name the manifest of a run, e.g. "feed20240801.run-20240801T224200.manifest.json".
+const ManifestSuffix = ".manifest.json"
+
+// runSeparator separates the run time from the name of the feed in a run prefix.
+const runSeparator = ".run-"
+
+// RunPrefix names the objects archived by the run at runAt after the feed,
+// e.g. "feed20240801.run-20240801T224200" of "feed20240801.json",
+// so that a re-run of the day does not replace the objects of the earlier run.
+func RunPrefix(feedName string, runAt time.Time) string {
+	return strings.TrimSuffix(feedName, path.Ext(feedName)) + runSeparator + runAt.Format("20060102T150405")
+}
+
+// feedPrefix removes the run time from the run prefix, e.g. "feed20240801" of "feed20240801.run-20240801T224200".
+// Run prefixes named before the run time was added are returned as they are.
+func feedPrefix(runPrefix string) string {
+	if i := strings.LastIndex(runPrefix, runSeparator); i >= 0 {
+		return runPrefix[:i]
+	}
+	return runPrefix
+}
+
+var pathPlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// ExpandPathTemplate names the object of date by a template such as "{yyyy}/{mm}/feed{yyyymmdd}.json".
+func ExpandPathTemplate(template string, date time.Time) string {
+	return strings.NewReplacer(
+		"{yyyymmdd}", date.Format("20060102"),
+		"{yyyy}", date.Format("2006"),
+		"{mm}", date.Format("01"),
+		"{dd}", date.Format("02"),
+	).Replace(template)
+}
+
+// ValidatePathTemplate checks that the template has known placeholders only,
+// and that it names the objects of different days differently.
+// The file name must not contain "_", which separates the source name added by the feeds.
+func ValidatePathTemplate(template string) error {
+	for _, placeholder := range pathPlaceholder.FindAllString(template, -1) {
+		switch placeholder {
+		case "{yyyymmdd}", "{yyyy}", "{mm}", "{dd}":
+		default:
+			return fmt.Errorf("unknown placeholder %s", placeholder)
+		}
+	}
+	if strings.HasPrefix(template, "/") {
+		return fmt.Errorf("must be relative")
+	}
+	if strings.Contains(path.Base(template), "_") {
+		return fmt.Errorf("file name must not contain \"_\", which separates the source name")
+	}
+	if !strings.Contains(template, "{yyyymmdd}") && !(strings.Contains(template, "{yyyy}") && strings.Contains(template, "{mm}") && strings.Contains(template, "{dd}")) {
+		return fmt.Errorf("must contain the date, {yyyymmdd} or {yyyy}, {mm} and {dd}")
+	}
+	return nil
+}
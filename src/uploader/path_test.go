@@ -0,0 +1,29 @@
+package uploader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandPathTemplate(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	date := time.Date(2024, time.August, 1, 22, 42, 0, 0, loc)
+
+	assert.Equal(t, "feed20240801.json", ExpandPathTemplate(DefaultPathTemplate, date))
+	assert.Equal(t, "2024/08/feed20240801.json", ExpandPathTemplate("{yyyy}/{mm}/feed{yyyymmdd}.json", date))
+	assert.Equal(t, "2024/08/01.json", ExpandPathTemplate("{yyyy}/{mm}/{dd}.json", date))
+}
+
+func TestValidatePathTemplate(t *testing.T) {
+	assert.Nil(t, ValidatePathTemplate(DefaultPathTemplate))
+	assert.Nil(t, ValidatePathTemplate("{yyyy}/{mm}/feed{yyyymmdd}.json"))
+	assert.Nil(t, ValidatePathTemplate("{yyyy}/{mm}/{dd}.json"))
+
+	assert.NotNil(t, ValidatePathTemplate("{yyyy}/{mm}/feed.json"))
+	assert.NotNil(t, ValidatePathTemplate("feed{yyyymmdd}_{hh}.json"))
+	assert.NotNil(t, ValidatePathTemplate("/feed{yyyymmdd}.json"))
+	assert.NotNil(t, ValidatePathTemplate("feed_{yyyymmdd}.json"))
+	assert.Nil(t, ValidatePathTemplate("new_books/feed{yyyymmdd}.json"))
+}
@@ -0,0 +1,87 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Settings locates a bucket of an S3-compatible storage, such as AWS S3 or MinIO.
+// Endpoint is a URL such as "https://s3.amazonaws.com" or "http://localhost:9000".
+// Empty keys read the credentials from the AWS environment variables.
+type S3Settings struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+type S3Uploader struct {
+	client    *minio.Client
+	bucket    string
+	directory string
+}
+
+func NewS3Uploader(settings *S3Settings, directory string) (*S3Uploader, error) {
+
+	endpoint, err := url.Parse(settings.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("Invalid S3 endpoint %q", settings.Endpoint)
+	}
+	creds := credentials.NewEnvAWS()
+	if settings.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(settings.AccessKeyID, settings.SecretAccessKey, "")
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:  creds,
+		Secure: endpoint.Scheme == "https",
+		Region: settings.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Cannot connect to S3: %s", err)
+	}
+
+	return &S3Uploader{
+		client:    client,
+		bucket:    settings.Bucket,
+		directory: directory,
+	}, nil
+}
+
+func (s *S3Uploader) Upload(object *UploadObject) error {
+	objectPath := path.Join(s.directory, object.ObjectName)
+	ctx := context.Background()
+	_, err := s.client.PutObject(ctx, s.bucket, objectPath, bytes.NewReader(object.Binary), int64(len(object.Binary)),
+		minio.PutObjectOptions{ContentType: object.ContentType})
+	if err != nil {
+		return fmt.Errorf("Cannot upload %s to S3: %s", object.ObjectName, err)
+	}
+
+	return nil
+}
+
+// Download reads back an object uploaded under the directory, e.g. an archived feed.
+func (s *S3Uploader) Download(objectName string) ([]byte, error) {
+	objectPath := path.Join(s.directory, objectName)
+	ctx := context.Background()
+	r, err := s.client.GetObject(ctx, s.bucket, objectPath, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Cannot download %s from S3: %s", objectName, err)
+	}
+	defer r.Close()
+
+	binary, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read %s from S3: %s", objectName, err)
+	}
+
+	return binary, nil
+}
@@ -0,0 +1,103 @@
+package uploader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// s3ServerStub keeps the objects put in path-style requests, as a MinIO server does.
+type s3ServerStub struct {
+	mu           sync.Mutex
+	objects      map[string][]byte
+	contentTypes map[string]string
+}
+
+func (s *s3ServerStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Header.Get("Authorization") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		binary, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+			binary = decodeAWSChunked(binary)
+		}
+		s.objects[r.URL.Path] = binary
+		s.contentTypes[r.URL.Path] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	case http.MethodGet:
+		binary, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		w.Header().Set("Last-Modified", time.Date(2024, time.August, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+		w.Header().Set("Content-Type", s.contentTypes[r.URL.Path])
+		w.Write(binary)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeAWSChunked joins the chunks of a streaming upload signed over plain HTTP,
+// given as "<hex size>;chunk-signature=<signature>\r\n<data>\r\n" up to a chunk of size 0.
+func decodeAWSChunked(body []byte) []byte {
+	var decoded []byte
+	for {
+		header := body[:bytes.Index(body, []byte("\r\n"))]
+		size, _ := strconv.ParseInt(string(bytes.SplitN(header, []byte(";"), 2)[0]), 16, 64)
+		if size == 0 {
+			return decoded
+		}
+		body = body[len(header)+2:]
+		decoded = append(decoded, body[:size]...)
+		body = body[size+2:]
+	}
+}
+
+func TestS3UploaderUploadsAndDownloads(t *testing.T) {
+	stub := &s3ServerStub{objects: map[string][]byte{}, contentTypes: map[string]string{}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	s3Uploader, err := NewS3Uploader(&S3Settings{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "feeds",
+		AccessKeyID:     "minioadmin",
+		SecretAccessKey: "minioadmin",
+	}, "archive")
+	assert.Nil(t, err)
+
+	err = s3Uploader.Upload(&UploadObject{ObjectName: "feed20240801.json", ContentType: "application/json", Binary: []byte(`{"title":"feed"}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`{"title":"feed"}`), stub.objects["/feeds/archive/feed20240801.json"])
+	assert.Equal(t, "application/json", stub.contentTypes["/feeds/archive/feed20240801.json"])
+
+	binary, err := s3Uploader.Download("feed20240801.json")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`{"title":"feed"}`), binary)
+
+	_, err = s3Uploader.Download("feed20240802.json")
+	assert.NotNil(t, err)
+}
+
+func TestNewS3UploaderRejectsInvalidEndpoint(t *testing.T) {
+	_, err := NewS3Uploader(&S3Settings{Endpoint: "localhost:9000", Bucket: "feeds"}, "")
+	assert.NotNil(t, err)
+}